@@ -0,0 +1,247 @@
+package pbthrift
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+
+	"github.com/YYCoder/protobuf-thrift/utils/logger"
+)
+
+// Name of the cache manifest written into output dir
+const CacheManifestName = ".protobuf-thrift-cache.json"
+
+// Content of the cache manifest, it records the previous run, so that files not changed since then can be skipped.
+type cacheManifest struct {
+	Version string                 `json:"version"` // tool version, cache of other versions is discarded
+	Config  string                 `json:"config"`  // hash of options affecting converted files
+	Files   map[string]*cacheEntry `json:"files"`   // absolute input path => entry, for converted files
+	Hashes  map[string]string      `json:"hashes"`  // absolute path => content hash, for converted and included files
+}
+
+type cacheEntry struct {
+	Output   string         `json:"output"` // output path relative to output dir
+	Includes []cacheInclude `json:"includes,omitempty"`
+}
+
+// File included by a converted file, output path is kept so that it can be followed without parsing the file
+type cacheInclude struct {
+	Path   string `json:"path"`
+	Output string `json:"output"`
+}
+
+// Cache of a single Generate, previous manifest is read only, the next one is filled by the goroutine calling parse.
+type cache struct {
+	conf     *RunnerConfig
+	previous *cacheManifest
+	next     *cacheManifest
+	persist  bool // whether the next manifest is written into output dir
+
+	mu     sync.Mutex
+	hashes map[string]string // absolute path => current content hash, empty if the file can not be read
+	once   sync.Once
+	dirty  map[string]bool // files of the previous run changed since then, or including changed files transitively
+}
+
+// Load the manifest in output dir, an empty one is used if it doesn't exist or is written by another version or config.
+func newCache(conf *RunnerConfig) (res *cache) {
+	res = newMemoryCache(conf, &cacheManifest{})
+	res.persist = true
+
+	content, err := os.ReadFile(filepath.Join(conf.OutputDir, CacheManifestName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return
+	} else if err != nil {
+		logger.Warnf("read cache manifest failed, convert all files: %v", err)
+		return
+	}
+	previous := &cacheManifest{}
+	if err = json.Unmarshal(content, previous); err != nil {
+		logger.Warnf("invalid cache manifest, convert all files: %v", err)
+		return
+	}
+	if previous.Version != Version || previous.Config != res.next.Config {
+		// outputs are still kept to find stale ones
+		logger.Info("cache manifest is written by another version or options, convert all files")
+		previous.Hashes = nil
+	}
+	res.previous = previous
+	return
+}
+
+// Create cache from the manifest of a previous run kept in memory, e.g. by watch mode, the next manifest is not written.
+func newMemoryCache(conf *RunnerConfig, previous *cacheManifest) (res *cache) {
+	return &cache{
+		conf:     conf,
+		previous: previous,
+		next:     newCacheManifest(configHash(conf)),
+		hashes:   make(map[string]string),
+	}
+}
+
+func newCacheManifest(config string) *cacheManifest {
+	return &cacheManifest{
+		Version: Version,
+		Config:  config,
+		Files:   make(map[string]*cacheEntry),
+		Hashes:  make(map[string]string),
+	}
+}
+
+// Return hash of options affecting converted files, paths of input and output are excluded, since the manifest is
+// in output dir and files are recorded by their paths.
+func configHash(conf *RunnerConfig) string {
+	options := []interface{}{
+		conf.Task, conf.Recursive, conf.BreakCycles, conf.SkipWeakImports, conf.ImportPaths, conf.ImportRoot,
+		conf.UseSpaceIndent, conf.IndentSpace, conf.FieldCase, conf.NameCase, conf.NestedTypes, conf.Syntax,
+		conf.Overrides,
+	}
+	// options are encoded as JSON rather than %#v, which prints addresses of pointers in overrides
+	content, _ := json.Marshal(options)
+	sum := sha256.Sum256(content)
+	return hex.EncodeToString(sum[:])
+}
+
+// Return content hash of the file, empty if it can not be read.
+func (c *cache) hash(path string) (res string) {
+	c.mu.Lock()
+	res, ok := c.hashes[path]
+	c.mu.Unlock()
+	if ok {
+		return
+	}
+
+	if file, err := openFile(c.conf.FS, path); err == nil {
+		h := sha256.New()
+		if _, err = io.Copy(h, file); err == nil {
+			res = hex.EncodeToString(h.Sum(nil))
+		}
+		file.Close()
+	}
+	c.mu.Lock()
+	c.hashes[path] = res
+	c.mu.Unlock()
+	return
+}
+
+// Return files included by the file in the previous run if neither it nor its transitive includes changed, and its
+// output still exists. It's safe to be called concurrently.
+func (c *cache) lookup(file FileInfo) (newFiles []FileInfo, ok bool) {
+	entry := c.previous.Files[file.absPath]
+	if entry == nil || filepath.Join(c.conf.OutputDir, filepath.FromSlash(entry.Output)) != file.outputPath {
+		return
+	}
+	if !fileExists(nil, file.outputPath) || !c.unchanged(file.absPath) {
+		return
+	}
+	for _, include := range entry.Includes {
+		newFiles = append(newFiles, FileInfo{
+			absPath:    include.Path,
+			outputPath: filepath.Join(c.conf.OutputDir, filepath.FromSlash(include.Output)),
+			includedBy: file.absPath,
+		})
+	}
+	return newFiles, true
+}
+
+// Return whether the file and files included by it transitively are the same as the previous run.
+func (c *cache) unchanged(path string) bool {
+	c.once.Do(c.findDirty)
+	_, found := c.previous.Hashes[path]
+	return found && !c.dirty[path]
+}
+
+// Hash files of the previous run, then mark changed files and files including them transitively as dirty.
+func (c *cache) findDirty() {
+	paths := []string{}
+	for path := range c.previous.Hashes {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	hashes := make([]string, len(paths))
+	runConcurrently(len(paths), c.conf.Concurrency, func(i int) {
+		hashes[i] = c.hash(paths[i])
+	})
+
+	includedBy := map[string][]string{}
+	for path, entry := range c.previous.Files {
+		for _, include := range entry.Includes {
+			includedBy[include.Path] = append(includedBy[include.Path], path)
+		}
+	}
+	c.dirty = make(map[string]bool)
+	queue := []string{}
+	for i, path := range paths {
+		if hashes[i] == "" || hashes[i] != c.previous.Hashes[path] {
+			c.dirty[path] = true
+			queue = append(queue, path)
+		}
+	}
+	for len(queue) > 0 {
+		path := queue[0]
+		queue = queue[1:]
+		for _, parent := range includedBy[path] {
+			if !c.dirty[parent] {
+				c.dirty[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+}
+
+// Record a converted or skipped file and files included by it in the next manifest.
+func (c *cache) record(file FileInfo, outputPath string, newFiles []FileInfo) {
+	entry := &cacheEntry{Output: outputPath}
+	for _, f := range newFiles {
+		output, err := filepath.Rel(c.conf.OutputDir, f.outputPath)
+		if err != nil {
+			output = f.outputPath
+		}
+		entry.Includes = append(entry.Includes, cacheInclude{Path: f.absPath, Output: filepath.ToSlash(output)})
+		c.next.Hashes[f.absPath] = c.hash(f.absPath)
+	}
+	c.next.Files[file.absPath] = entry
+	c.next.Hashes[file.absPath] = c.hash(file.absPath)
+}
+
+// Return input paths of the previous run whose outputs are not outputs any more, e.g. the input files are removed,
+// sorted by their outputs.
+func (c *cache) staleFiles() (res []string) {
+	outputs := map[string]bool{}
+	for _, entry := range c.next.Files {
+		outputs[entry.Output] = true
+	}
+	for path, entry := range c.previous.Files {
+		if !outputs[entry.Output] {
+			res = append(res, path)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return c.previous.Files[res[i]].Output < c.previous.Files[res[j]].Output
+	})
+	return
+}
+
+// Keep a stale output in the next manifest, so that it can still be found and deleted by later runs.
+func (c *cache) keepStale(path string) {
+	c.next.Files[path] = &cacheEntry{Output: c.previous.Files[path].Output}
+}
+
+// Write the next manifest into output dir if it should be persisted.
+func (c *cache) save() (err error) {
+	if !c.persist {
+		return
+	}
+	content, err := json.MarshalIndent(c.next, "", "  ")
+	if err != nil {
+		return
+	}
+	return os.WriteFile(filepath.Join(c.conf.OutputDir, CacheManifestName), append(content, '\n'), 0644)
+}
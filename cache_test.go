@@ -0,0 +1,166 @@
+package pbthrift
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Write files into the dir by slash separated paths relative to it.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for path, content := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// Run the config, return the files written by it according to the summary.
+func runWritten(t *testing.T, config RunnerConfig) (res []string) {
+	t.Helper()
+	var summary bytes.Buffer
+	config.Summary = &summary
+	r, err := NewRunnerWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = r.Run(); err != nil {
+		t.Fatal(err)
+	}
+	lines := strings.Split(strings.TrimSpace(summary.String()), "\n")
+	return append([]string{}, lines[1:]...)
+}
+
+func TestCache(t *testing.T) {
+	type step struct {
+		name    string
+		files   map[string]string // files written into input dir before the run, empty content removes the file
+		config  func(c *RunnerConfig)
+		written []string
+		exist   []string // output files existing after the run
+		missing []string // output files not existing after the run
+	}
+	cases := []struct {
+		name   string
+		task   int
+		config RunnerConfig
+		files  map[string]string
+		steps  []step
+	}{
+		{
+			name: "proto2thrift",
+			task: TASK_FILE_PROTO2THRIFT,
+			files: map[string]string{
+				"a.proto":        "syntax = \"proto3\";\npackage a;\nimport \"common/b.proto\";\nmessage A {\n\tb.B b = 1;\n}\n",
+				"c.proto":        "syntax = \"proto3\";\npackage c;\nmessage C {\n\tstring id = 1;\n}\n",
+				"common/b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {\n\tstring id = 1;\n}\n",
+			},
+			steps: []step{
+				{name: "first run", written: []string{"a.thrift", "c.thrift", "common/b.thrift"}},
+				{name: "unchanged files are skipped", written: []string{}},
+				{
+					name:    "dependants of changed file are converted",
+					files:   map[string]string{"common/b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {\n\tstring name = 1;\n}\n"},
+					written: []string{"a.thrift", "common/b.thrift"},
+				},
+				{
+					name:    "config change converts all files",
+					config:  func(c *RunnerConfig) { c.NameCase = "pascalCase" },
+					written: []string{"a.thrift", "c.thrift", "common/b.thrift"},
+				},
+				{
+					name:    "stale output is kept",
+					config:  func(c *RunnerConfig) { c.NameCase = "pascalCase" },
+					files:   map[string]string{"c.proto": ""},
+					written: []string{},
+					exist:   []string{"c.thrift"},
+				},
+				{
+					name: "stale output is deleted",
+					config: func(c *RunnerConfig) {
+						c.NameCase = "pascalCase"
+						c.DeleteStale = true
+					},
+					written: []string{},
+					missing: []string{"c.thrift"},
+				},
+			},
+		},
+		{
+			name: "common files of cycles",
+			task: TASK_FILE_THRIFT2PROTO,
+			config: RunnerConfig{
+				BreakCycles: true,
+				DeleteStale: true,
+			},
+			files: map[string]string{
+				"a.thrift": "namespace go foo\ninclude \"b.thrift\"\nstruct A {\n\t1: b.B b\n}\n",
+				"b.thrift": "namespace go foo\ninclude \"a.thrift\"\nstruct B {\n\t1: a.A a\n}\n",
+				"c.thrift": "namespace go bar\nstruct C {\n\t1: string id\n}\n",
+			},
+			steps: []step{
+				{name: "first run", written: []string{"a.proto", "a_common.proto", "b.proto", "c.proto"}},
+				{
+					// members are converted again to fill the common file, which is not stale
+					name:    "members of cycles are always converted",
+					written: []string{"a.proto", "a_common.proto", "b.proto"},
+					exist:   []string{"a_common.proto"},
+				},
+				{
+					name:    "common file is stale once the cycle is gone",
+					files:   map[string]string{"b.thrift": "namespace go foo\nstruct B {\n\t1: string id\n}\n"},
+					written: []string{"a.proto", "b.proto"},
+					missing: []string{"a_common.proto"},
+				},
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			input, output := t.TempDir(), t.TempDir()
+			writeFiles(t, input, c.files)
+			for _, s := range c.steps {
+				files := map[string]string{}
+				for path, content := range s.files {
+					if content != "" {
+						files[path] = content
+					} else if err := os.Remove(filepath.Join(input, filepath.FromSlash(path))); err != nil {
+						t.Fatal(err)
+					}
+				}
+				writeFiles(t, input, files)
+
+				config := c.config
+				config.Task = c.task
+				config.InputPath = input
+				config.OutputDir = output
+				config.Recursive = true
+				config.Cache = true
+				if s.config != nil {
+					s.config(&config)
+				}
+				if written := runWritten(t, config); !reflect.DeepEqual(written, s.written) {
+					t.Errorf("%s: written = %q, want %q", s.name, written, s.written)
+				}
+				for _, path := range s.exist {
+					if !fileExists(nil, filepath.Join(output, path)) {
+						t.Errorf("%s: %s doesn't exist", s.name, path)
+					}
+				}
+				for _, path := range s.missing {
+					if fileExists(nil, filepath.Join(output, path)) {
+						t.Errorf("%s: %s exists", s.name, path)
+					}
+				}
+			}
+		})
+	}
+}
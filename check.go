@@ -0,0 +1,79 @@
+package pbthrift
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Convert files in memory and compare them with files in output dir, unified diff of each file out of date is written
+// to w. CheckError is returned if any file differs, is missing or would be refused, nothing is written into output
+// dir.
+func (r *Runner) Check(w io.Writer) (err error) {
+	if r.Config.Task != TASK_FILE_PROTO2THRIFT && r.Config.Task != TASK_FILE_THRIFT2PROTO {
+		return &OptionError{Option: "check", Value: "true", Reason: "it requires input file"}
+	}
+	var files []GeneratedFile
+	if files, err = r.PipeAll(); err != nil {
+		return
+	}
+
+	var outdated, refused []string
+	for _, file := range files {
+		var current []byte
+		var status string
+		if current, status, err = compareWithDisk(file, r.Config.Force); err != nil {
+			return
+		} else if status == StatusUnchanged {
+			continue
+		}
+
+		name := file.Path
+		if rel, relErr := filepath.Rel(r.Config.OutputDir, file.Path); relErr == nil {
+			name = filepath.ToSlash(rel)
+		}
+		from := "a/" + name
+		if status == StatusCreated {
+			from = "/dev/null"
+		}
+		if _, err = io.WriteString(w, unifiedDiff(from, "b/"+name, current, file.Content)); err != nil {
+			return
+		}
+		if status == StatusRefused {
+			refused = append(refused, name)
+		} else {
+			outdated = append(outdated, name)
+		}
+	}
+	if len(outdated) > 0 || len(refused) > 0 {
+		err = &CheckError{Paths: outdated, Refused: refused}
+	}
+	return
+}
+
+// Status of a converted file compared with the file on disk
+const (
+	StatusCreated   = "created"
+	StatusChanged   = "changed"
+	StatusUnchanged = "unchanged"
+	StatusRefused   = "refused" // existing file without generated header, it's not overwritten unless forced
+)
+
+// Compare converted file with the file at its output path, return current content on disk and status of the file.
+func compareWithDisk(file GeneratedFile, force bool) (current []byte, status string, err error) {
+	current, err = os.ReadFile(file.Path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		return nil, StatusCreated, nil
+	case err != nil:
+		return nil, "", &FileError{Op: "read", Path: file.Path, Err: err}
+	case !force && !isGenerated(current):
+		return current, StatusRefused, nil
+	case bytes.Equal(current, file.Content):
+		return current, StatusUnchanged, nil
+	}
+	return current, StatusChanged, nil
+}
@@ -0,0 +1,41 @@
+package pbthrift
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCompareWithDisk(t *testing.T) {
+	generated := []byte("// generated by protobuf-thrift from a.proto; DO NOT EDIT\n\nstruct a {\n}\n")
+	cases := []struct {
+		name    string
+		current []byte // nil if the file does not exist
+		force   bool
+		status  string
+	}{
+		{name: "missing", status: StatusCreated},
+		{name: "same", current: generated, status: StatusUnchanged},
+		{name: "generated and outdated", current: []byte("// generated by protobuf-thrift from a.proto; DO NOT EDIT\n"), status: StatusChanged},
+		{name: "hand-written", current: []byte("struct a {\n}\n"), status: StatusRefused},
+		{name: "hand-written and forced", current: []byte("struct a {\n}\n"), force: true, status: StatusChanged},
+		{name: "empty", current: []byte{}, status: StatusRefused},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "a.thrift")
+			if c.current != nil {
+				if err := os.WriteFile(path, c.current, 0644); err != nil {
+					t.Fatal(err)
+				}
+			}
+			_, status, err := compareWithDisk(GeneratedFile{Path: path, Content: generated}, c.force)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if status != c.status {
+				t.Errorf("status = %q, want %q", status, c.status)
+			}
+		})
+	}
+}
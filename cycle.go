@@ -0,0 +1,372 @@
+package pbthrift
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/YYCoder/protobuf-thrift/utils/logger"
+)
+
+// Files in an include cycle, whose type declarations are moved into a generated common file to break the cycle
+type cycleInfo struct {
+	members  []string   // absolute paths for files in the cycle, sorted
+	common   FileInfo   // generated common file holding types moved from members
+	pkg      string     // package or namespace of the common file, which is the one of the first member
+	includes []FileInfo // files included by members but not in the cycle
+	elements []Element  // type declarations moved from members
+	// absolute path => package or namespace of each member, types can only be moved when they are the same
+	packages map[string]string
+}
+
+// Record package or namespace of the member, the first member's is used by the common file.
+func (c *cycleInfo) setPackage(absPath string, pkg string) {
+	c.packages[absPath] = pkg
+	if c.members[0] == absPath {
+		c.pkg = pkg
+	}
+}
+
+func (c *cycleInfo) contains(absPath string) bool {
+	for _, m := range c.members {
+		if m == absPath {
+			return true
+		}
+	}
+	return false
+}
+
+// Include alias of the common file, which is its file name without extension.
+func (c *cycleInfo) alias() string {
+	base := filepath.Base(c.common.outputPath)
+	return strings.TrimSuffix(base, filepath.Ext(base))
+}
+
+func (c *cycleInfo) addInclude(file FileInfo) {
+	for _, f := range c.includes {
+		if f.absPath == file.absPath {
+			return
+		}
+	}
+	c.includes = append(c.includes, file)
+}
+
+// Return the path used in include or import declaration of current file for the included file.
+func includePathFor(importRoot string, currentOutputPath string, includedOutputPath string) string {
+	rel, err := filepath.Rel(filepath.Dir(currentOutputPath), includedOutputPath)
+	if err != nil {
+		rel = includedOutputPath
+	}
+	return importPathFromRoot(importRoot, includedOutputPath, filepath.ToSlash(rel))
+}
+
+// Detect include cycles in dependency graph, since thrift forbids cyclic includes and protoc reports them as error.
+// If BreakCycles option is on, types in each cycle will be moved to a generated common file, otherwise return error
+// with full paths of all cycles.
+func (g *generator) handleCycles() (err error) {
+	cycles := g.findCycles()
+	if len(cycles) == 0 {
+		return
+	}
+
+	if !g.conf.BreakCycles {
+		cycleErr := &CycleError{}
+		for _, members := range cycles {
+			cycleErr.Paths = append(cycleErr.Paths, g.cyclePath(members))
+		}
+		return cycleErr
+	}
+	// all cycles are known before breaking any of them, since members of one cycle may include members of another
+	infos := []*cycleInfo{}
+	g.cycles = make(map[string]*cycleInfo)
+	for _, members := range cycles {
+		cycle := g.newCycleInfo(members)
+		for _, m := range members {
+			g.cycles[m] = cycle
+		}
+		infos = append(infos, cycle)
+	}
+	for _, cycle := range infos {
+		if err = g.breakCycle(cycle); err != nil {
+			return
+		}
+	}
+	return g.convertCycleDependants()
+}
+
+// Return the broken include cycle containing the file, nil if there is not.
+func (g *generator) cycleOf(absPath string) *cycleInfo {
+	return g.cycles[absPath]
+}
+
+// Find strongly connected components in the dependency graph by tarjan algorithm, each component containing more than
+// one file or a file including itself is a cycle. Members of each cycle are sorted.
+func (g *generator) findCycles() (res [][]string) {
+	nodes := []string{}
+	for node := range g.dependencies {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	index := 0
+	indexes := map[string]int{}
+	lowLinks := map[string]int{}
+	onStack := map[string]bool{}
+	stack := []string{}
+
+	var connect func(node string)
+	connect = func(node string) {
+		indexes[node] = index
+		lowLinks[node] = index
+		index++
+		stack = append(stack, node)
+		onStack[node] = true
+
+		for _, next := range g.dependencies[node] {
+			if _, visited := indexes[next]; !visited {
+				connect(next)
+				if lowLinks[next] < lowLinks[node] {
+					lowLinks[node] = lowLinks[next]
+				}
+			} else if onStack[next] && indexes[next] < lowLinks[node] {
+				lowLinks[node] = indexes[next]
+			}
+		}
+
+		if lowLinks[node] != indexes[node] {
+			return
+		}
+		component := []string{}
+		for {
+			last := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[last] = false
+			component = append(component, last)
+			if last == node {
+				break
+			}
+		}
+		if len(component) > 1 || g.includes(node, node) {
+			sort.Strings(component)
+			res = append(res, component)
+		}
+	}
+
+	for _, node := range nodes {
+		if _, visited := indexes[node]; !visited {
+			connect(node)
+		}
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i][0] < res[j][0]
+	})
+	return
+}
+
+func (g *generator) includes(from string, to string) bool {
+	for _, f := range g.dependencies[from] {
+		if f == to {
+			return true
+		}
+	}
+	return false
+}
+
+// Return the shortest cycle path starting and ending with the first member, e.g. [a b c a].
+func (g *generator) cyclePath(members []string) (res []string) {
+	inCycle := map[string]bool{}
+	for _, m := range members {
+		inCycle[m] = true
+	}
+	start := members[0]
+	parents := map[string]string{}
+	queue := []string{start}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, next := range g.dependencies[node] {
+			if next == start {
+				res = []string{start}
+				for n := node; n != start; n = parents[n] {
+					res = append([]string{n}, res...)
+				}
+				return append([]string{start}, res...)
+			}
+			if _, visited := parents[next]; visited || !inCycle[next] {
+				continue
+			}
+			parents[next] = node
+			queue = append(queue, next)
+		}
+	}
+	return members
+}
+
+// Return the cycle whose common file is next to the first member.
+func (g *generator) newCycleInfo(members []string) *cycleInfo {
+	first := g.fileInfos[members[0]]
+	absExt, outputExt := filepath.Ext(first.absPath), filepath.Ext(first.outputPath)
+	return &cycleInfo{
+		members: members,
+		common: FileInfo{
+			absPath:    strings.TrimSuffix(first.absPath, absExt) + "_common" + absExt,
+			outputPath: strings.TrimSuffix(first.outputPath, outputExt) + "_common" + outputExt,
+		},
+		packages: make(map[string]string),
+	}
+}
+
+// Regenerate files in the cycle, their type declarations will be moved to the common file, and their includes of each
+// other will be replaced with the common file. Members must have the same package or namespace, otherwise types
+// moved to the common file would be renamed.
+func (g *generator) breakCycle(cycle *cycleInfo) (err error) {
+	members := cycle.members
+	logger.Warnf("cyclic include found: %s, break it by moving types to %s", strings.Join(g.cyclePath(members), " -> "), cycle.common.outputPath)
+
+	for _, m := range members {
+		var sub SubGenerator
+		if sub, err = g.newSubGenerator(g.fileInfos[m], cycle); err != nil {
+			return
+		}
+		if _, err = sub.Parse(); err != nil {
+			return &FileError{Op: "parse", Path: m, Err: err}
+		}
+		g.subGeneratorMap[m] = sub
+	}
+	for _, m := range members[1:] {
+		if pkg := cycle.packages[m]; pkg != cycle.pkg {
+			return &FileError{
+				Op:   "break cycle",
+				Path: m,
+				Err: fmt.Errorf("%w, its package %q is different from %q of %v, types can not be moved to the same file",
+					ErrCyclicInclude, pkg, cycle.pkg, members[0]),
+			}
+		}
+	}
+
+	common := &commonGenerator{
+		conf:  g.conf,
+		cycle: cycle,
+	}
+	if _, err = common.Parse(); err != nil {
+		return
+	}
+	g.subGeneratorMap[cycle.common.absPath] = common
+	g.fileInfos[cycle.common.absPath] = cycle.common
+	// members include the common file instead of each other now, and the common file includes what members include
+	for _, m := range members {
+		g.dependencies[m] = append(g.dependencies[m], cycle.common.absPath)
+	}
+	for _, file := range cycle.includes {
+		g.dependencies[cycle.common.absPath] = append(g.dependencies[cycle.common.absPath], file.absPath)
+	}
+	return
+}
+
+// Convert files depending on members of broken cycles again, directly or not, so that types moved to common files are
+// referred from the common files.
+func (g *generator) convertCycleDependants() (err error) {
+	paths := []string{}
+	for path, sub := range g.subGeneratorMap {
+		if _, isCommon := sub.(*commonGenerator); !isCommon && g.cycles[path] == nil {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+
+	for _, path := range paths {
+		moved := g.movedDependencies(path)
+		if len(moved) == 0 {
+			continue
+		}
+		var sub SubGenerator
+		if sub, err = g.newSubGenerator(g.fileInfos[path], nil); err != nil {
+			return
+		}
+		if _, err = sub.Parse(); err != nil {
+			return &FileError{Op: "parse", Path: path, Err: err}
+		}
+		g.subGeneratorMap[path] = sub
+		for _, cycle := range moved {
+			g.dependencies[path] = append(g.dependencies[path], cycle.common.absPath)
+		}
+	}
+	return
+}
+
+// Return broken cycles containing files the file depends on directly or not, in order of their first members.
+func (g *generator) movedDependencies(path string) (res []*cycleInfo) {
+	found := map[*cycleInfo]bool{}
+	visited := map[string]bool{path: true}
+	queue := []string{path}
+	for len(queue) > 0 {
+		node := queue[0]
+		queue = queue[1:]
+		for _, next := range g.dependencies[node] {
+			if visited[next] {
+				continue
+			}
+			visited[next] = true
+			if cycle := g.cycles[next]; cycle != nil {
+				found[cycle] = true
+				continue
+			}
+			queue = append(queue, next)
+		}
+	}
+	for cycle := range found {
+		res = append(res, cycle)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].members[0] < res[j].members[0]
+	})
+	return
+}
+
+// Generator for the common file holding types moved from files in an include cycle
+type commonGenerator struct {
+	conf    *RunnerConfig
+	cycle   *cycleInfo
+	content bytes.Buffer
+}
+
+func (g *commonGenerator) FilePath() (res string) {
+	return g.cycle.common.absPath
+}
+
+// Print the common file, including package or namespace and includes of all members, then type declarations moved
+// from members.
+func (g *commonGenerator) Parse() (newFiles []FileInfo, err error) {
+	schema := &Schema{}
+	if g.cycle.pkg != "" {
+		schema.Elements = append(schema.Elements, &Package{Name: g.cycle.pkg})
+	}
+	for _, file := range g.cycle.includes {
+		schema.Elements = append(schema.Elements, &Import{
+			Path: includePathFor(g.conf.ImportRoot, g.cycle.common.outputPath, file.outputPath),
+		})
+	}
+	protoFile := g.conf.Task != TASK_FILE_PROTO2THRIFT
+	if protoFile && len(g.cycle.includes) > 0 {
+		setBlankAbove(schema.Elements[len(schema.Elements)-len(g.cycle.includes)], 1)
+	}
+	if len(g.cycle.elements) > 0 && (protoFile || len(g.cycle.includes) > 0) {
+		setBlankAbove(g.cycle.elements[0], 1)
+	}
+	schema.Elements = append(schema.Elements, g.cycle.elements...)
+
+	indent := indentUnit(g.conf.UseSpaceIndent, g.conf.IndentSpace)
+	if protoFile {
+		schema.Syntax = g.conf.Syntax
+		g.content.Write(PrintProto(schema, indent))
+	} else {
+		g.content.Write(PrintThrift(schema, indent))
+	}
+	return
+}
+
+func (g *commonGenerator) Pipe() (res []byte, err error) {
+	return g.content.Bytes(), nil
+}
@@ -0,0 +1,258 @@
+package pbthrift
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Thrift file in namespace pkg including the files, with a struct referring the type of each included file, which is
+// named after the file in upper case.
+func cyclicThrift(pkg string, name string, includes ...string) *fstest.MapFile {
+	content := fmt.Sprintf("namespace go %s\n\n", pkg)
+	for _, include := range includes {
+		content += fmt.Sprintf("include \"%s.thrift\"\n", include)
+	}
+	content += fmt.Sprintf("\nstruct %s {\n", name)
+	for i, include := range includes {
+		content += fmt.Sprintf("\t%d: %s.%s %s\n", i+1, include, strings.ToUpper(include), include)
+	}
+	return &fstest.MapFile{Data: []byte(content + "}\n")}
+}
+
+var cyclicThrifts = fstest.MapFS{
+	// 2-cycle a <-> b, and d including a from outside of the cycle
+	"two/a.thrift": cyclicThrift("foo", "A", "b"),
+	"two/b.thrift": cyclicThrift("foo", "B", "a"),
+	"two/d.thrift": cyclicThrift("bar", "D", "a"),
+	// 3-cycle a -> b -> c -> a
+	"three/a.thrift": cyclicThrift("foo", "A", "b"),
+	"three/b.thrift": cyclicThrift("foo", "B", "c"),
+	"three/c.thrift": cyclicThrift("foo", "C", "a"),
+	// a -> b -> c -> a with a shortcut a -> c, the shortest cycle of a is reported
+	"short/a.thrift": cyclicThrift("foo", "A", "b", "c"),
+	"short/b.thrift": cyclicThrift("foo", "B", "c"),
+	"short/c.thrift": cyclicThrift("foo", "C", "a"),
+	// self-include
+	"self/s.thrift": cyclicThrift("foo", "S", "s"),
+	// two separate cycles a <-> b and c <-> s included by the input
+	"many/d.thrift": cyclicThrift("foo", "D", "a", "c"),
+	"many/a.thrift": cyclicThrift("foo", "A", "b"),
+	"many/b.thrift": cyclicThrift("foo", "B", "a"),
+	"many/c.thrift": cyclicThrift("foo", "C", "s"),
+	"many/s.thrift": cyclicThrift("foo", "S", "c"),
+	// 2-cycle between different namespaces
+	"mismatch/a.thrift": cyclicThrift("foo.a", "A", "b"),
+	"mismatch/b.thrift": cyclicThrift("foo.b", "B", "a"),
+}
+
+func convertCyclicThrifts(input string, breakCycles bool) (res map[string]string, err error) {
+	r, err := NewRunnerWithConfig(RunnerConfig{
+		FS:          cyclicThrifts,
+		Task:        TASK_FILE_THRIFT2PROTO,
+		InputPath:   input,
+		OutputDir:   "/out",
+		Recursive:   true,
+		BreakCycles: breakCycles,
+		NameCase:    "pascalCase",
+		FieldCase:   "snakeCase",
+	})
+	if err != nil {
+		return
+	}
+	files, err := r.PipeAll()
+	res = map[string]string{}
+	for _, f := range files {
+		res[f.Path] = string(f.Content)
+	}
+	return
+}
+
+func TestCycleError(t *testing.T) {
+	cases := []struct {
+		input string
+		paths [][]string
+	}{
+		{"two/d.thrift", [][]string{{"/two/a.thrift", "/two/b.thrift", "/two/a.thrift"}}},
+		{"three/a.thrift", [][]string{{"/three/a.thrift", "/three/b.thrift", "/three/c.thrift", "/three/a.thrift"}}},
+		{"short/a.thrift", [][]string{{"/short/a.thrift", "/short/c.thrift", "/short/a.thrift"}}},
+		{"self/s.thrift", [][]string{{"/self/s.thrift", "/self/s.thrift"}}},
+		{"many/d.thrift", [][]string{
+			{"/many/a.thrift", "/many/b.thrift", "/many/a.thrift"},
+			{"/many/c.thrift", "/many/s.thrift", "/many/c.thrift"},
+		}},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			_, err := convertCyclicThrifts(c.input, false)
+			var cycleErr *CycleError
+			if !errors.As(err, &cycleErr) || !errors.Is(err, ErrCyclicInclude) {
+				t.Fatalf("err = %v, want CycleError", err)
+			}
+			if !reflect.DeepEqual(cycleErr.Paths, c.paths) {
+				t.Errorf("paths = %q, want %q", cycleErr.Paths, c.paths)
+			}
+		})
+	}
+}
+
+func TestBreakCycles(t *testing.T) {
+	header := func(sources string) string {
+		return "// generated by protobuf-thrift from " + sources + "; DO NOT EDIT\n\nsyntax = \"proto3\";\n"
+	}
+	member := func(name string) string {
+		return header(name+".thrift") + "package foo;\n\nimport public \"a_common.proto\";\n"
+	}
+	cases := []struct {
+		input string
+		want  map[string]string
+	}{
+		{
+			input: "two/d.thrift",
+			want: map[string]string{
+				"/out/a.proto": member("a"),
+				"/out/b.proto": member("b"),
+				"/out/a_common.proto": header("a.thrift, b.thrift") + `package foo;
+
+message A {
+	B b = 1;
+}
+
+message B {
+	A a = 1;
+}
+`,
+				// dependants outside of the cycle refer to the common file
+				"/out/d.proto": header("d.thrift") + `package bar;
+
+import "a_common.proto";
+
+message D {
+	foo.A a = 1;
+}
+`,
+			},
+		},
+		{
+			input: "three/a.thrift",
+			want: map[string]string{
+				"/out/a.proto": member("a"),
+				"/out/b.proto": member("b"),
+				"/out/c.proto": member("c"),
+				"/out/a_common.proto": header("a.thrift, b.thrift, c.thrift") + `package foo;
+
+message A {
+	B b = 1;
+}
+
+message B {
+	C c = 1;
+}
+
+message C {
+	A a = 1;
+}
+`,
+			},
+		},
+		{
+			input: "self/s.thrift",
+			want: map[string]string{
+				"/out/s.proto": header("s.thrift") + "package foo;\n\nimport public \"s_common.proto\";\n",
+				"/out/s_common.proto": header("s.thrift") + `package foo;
+
+message S {
+	S s = 1;
+}
+`,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.input, func(t *testing.T) {
+			files, err := convertCyclicThrifts(c.input, true)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(files) != len(c.want) {
+				t.Errorf("converted files = %d, want %d", len(files), len(c.want))
+			}
+			for path, want := range c.want {
+				if got := files[path]; got != want {
+					t.Errorf("%s =\n%s\nwant\n%s", path, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBreakCyclesProto2Thrift(t *testing.T) {
+	proto := func(name string, include string, ref string) *fstest.MapFile {
+		return &fstest.MapFile{Data: []byte(fmt.Sprintf(
+			"syntax = \"proto3\";\npackage foo;\n\nimport \"%s.proto\";\n\nmessage %s {\n\t%s ref = 1;\n}\n", include, name, ref))}
+	}
+	r, err := NewRunnerWithConfig(RunnerConfig{
+		FS: fstest.MapFS{
+			"idl/a.proto": proto("A", "b", "B"),
+			"idl/b.proto": proto("B", "c", "C"),
+			"idl/c.proto": proto("C", "a", "A"),
+		},
+		Task:        TASK_FILE_PROTO2THRIFT,
+		InputPath:   "idl/a.proto",
+		OutputDir:   "/out",
+		Recursive:   true,
+		BreakCycles: true,
+		NameCase:    "pascalCase",
+		FieldCase:   "snakeCase",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := r.PipeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := map[string]string{}
+	for _, f := range files {
+		got[f.Path] = string(f.Content)
+	}
+	member := func(name string) string {
+		return "// generated by protobuf-thrift from " + name + ".proto; DO NOT EDIT\n\nnamespace * foo\n\ninclude \"a_common.thrift\"\n"
+	}
+	want := map[string]string{
+		"/out/a.thrift": member("a"),
+		"/out/b.thrift": member("b"),
+		"/out/c.thrift": member("c"),
+		"/out/a_common.thrift": `// generated by protobuf-thrift from a.proto, b.proto, c.proto; DO NOT EDIT
+
+namespace * foo
+
+struct A {
+	1: B ref
+}
+struct B {
+	1: C ref
+}
+struct C {
+	1: A ref
+}
+`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("files =\n%q\nwant\n%q", got, want)
+	}
+}
+
+func TestBreakCyclesPackageMismatch(t *testing.T) {
+	_, err := convertCyclicThrifts("mismatch/a.thrift", true)
+	var fileErr *FileError
+	if !errors.As(err, &fileErr) || !errors.Is(err, ErrCyclicInclude) {
+		t.Fatalf("err = %v, want FileError matching ErrCyclicInclude", err)
+	}
+	if fileErr.Op != "break cycle" || fileErr.Path != "/mismatch/b.thrift" {
+		t.Errorf("err = %v, want break cycle error of /mismatch/b.thrift", err)
+	}
+}
@@ -0,0 +1,190 @@
+package pbthrift
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Lines of context around changes in unified diff
+const diffContext = 3
+
+// Line of an edit script, kind is ' ' for unchanged line, '-' for deleted line and '+' for inserted line
+type diffLine struct {
+	kind byte
+	text string // including line break, if any
+}
+
+// Return unified diff from one content to another, empty if they are the same.
+func unifiedDiff(fromName string, toName string, from []byte, to []byte) (res string) {
+	lines := diffLines(splitLines(string(from)), splitLines(string(to)))
+	var buf strings.Builder
+	// line numbers in both contents before each line of the edit script
+	fromLine, toLine := make([]int, len(lines)+1), make([]int, len(lines)+1)
+	for i, l := range lines {
+		fromLine[i+1], toLine[i+1] = fromLine[i], toLine[i]
+		if l.kind != '+' {
+			fromLine[i+1]++
+		}
+		if l.kind != '-' {
+			toLine[i+1]++
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		for i < len(lines) && lines[i].kind == ' ' {
+			i++
+		}
+		if i == len(lines) {
+			break
+		}
+		// extend the hunk until unchanged lines are enough to separate it from the next change
+		start, end := i-diffContext, i
+		if start < 0 {
+			start = 0
+		}
+		for end < len(lines) {
+			if lines[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(lines) && lines[next].kind == ' ' {
+				next++
+			}
+			if next == len(lines) || next-end > 2*diffContext {
+				end += diffContext
+				if end > len(lines) {
+					end = len(lines)
+				}
+				break
+			}
+			end = next
+		}
+
+		if buf.Len() == 0 {
+			buf.WriteString(fmt.Sprintf("--- %s\n+++ %s\n", fromName, toName))
+		}
+		buf.WriteString(fmt.Sprintf("@@ -%s +%s @@\n",
+			hunkRange(fromLine[start], fromLine[end]-fromLine[start]), hunkRange(toLine[start], toLine[end]-toLine[start])))
+		for _, l := range lines[start:end] {
+			buf.WriteByte(l.kind)
+			buf.WriteString(l.text)
+			if !strings.HasSuffix(l.text, "\n") {
+				buf.WriteString("\n\\ No newline at end of file\n")
+			}
+		}
+		i = end
+	}
+	return buf.String()
+}
+
+// Return range of hunk header, start is the count of lines before the hunk.
+func hunkRange(start int, count int) string {
+	switch count {
+	case 0:
+		return fmt.Sprintf("%d,0", start)
+	case 1:
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, count)
+}
+
+// Split content into lines, each line keeps its line break, so that a missing one at the end is a difference.
+func splitLines(content string) (res []string) {
+	for content != "" {
+		end := strings.IndexByte(content, '\n') + 1
+		if end == 0 {
+			end = len(content)
+		}
+		res = append(res, content[:end])
+		content = content[end:]
+	}
+	return
+}
+
+// Return the shortest edit script from lines a to lines b by myers algorithm.
+func diffLines(a []string, b []string) (res []diffLine) {
+	// common prefix and suffix are unchanged, which keeps the search small for similar contents
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+	for _, line := range a[:prefix] {
+		res = append(res, diffLine{kind: ' ', text: line})
+	}
+	res = append(res, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, line := range a[len(a)-suffix:] {
+		res = append(res, diffLine{kind: ' ', text: line})
+	}
+	return
+}
+
+func myers(a []string, b []string) (res []diffLine) {
+	n, m := len(a), len(b)
+	// v[k+offset] is the furthest x on diagonal k, offset leaves room for diagonals -d-1 and d+1
+	offset := n + m + 1
+	v := make([]int, 2*offset+1)
+	// trace[d] keeps diagonals -d-1 to d+1 of v before round d to walk back the path, so that memory is O(D^2) instead
+	// of O((n+m)*D), trace[d][k+d+1] is v[k+offset]
+	trace := [][]int{}
+search:
+	for d := 0; d <= n+m; d++ {
+		trace = append(trace, append([]int{}, v[offset-d-1:offset+d+2]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[k-1+offset] < v[k+1+offset]) {
+				x = v[k+1+offset]
+			} else {
+				x = v[k-1+offset] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[k+offset] = x
+			if x >= n && y >= m {
+				break search
+			}
+		}
+	}
+
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		v := trace[d]
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v[k-1+d+1] < v[k+1+d+1]) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := v[prevK+d+1]
+		prevY := prevX - prevK
+		for x > prevX && y > prevY {
+			res = append(res, diffLine{kind: ' ', text: a[x-1]})
+			x--
+			y--
+		}
+		if x == prevX {
+			res = append(res, diffLine{kind: '+', text: b[y-1]})
+			y--
+		} else {
+			res = append(res, diffLine{kind: '-', text: a[x-1]})
+			x--
+		}
+	}
+	for x > 0 && y > 0 {
+		res = append(res, diffLine{kind: ' ', text: a[x-1]})
+		x--
+		y--
+	}
+	for i, j := 0, len(res)-1; i < j; i, j = i+1, j-1 {
+		res[i], res[j] = res[j], res[i]
+	}
+	return
+}
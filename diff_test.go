@@ -0,0 +1,144 @@
+package pbthrift
+
+import (
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	tests := []struct {
+		name string
+		from string
+		to   string
+		want string
+	}{
+		{
+			name: "identical",
+			from: "a\nb\n",
+			to:   "a\nb\n",
+			want: "",
+		},
+		{
+			name: "insert at start",
+			from: "b\nc\n",
+			to:   "a\nb\nc\n",
+			want: "--- a\n+++ b\n@@ -1,2 +1,3 @@\n+a\n b\n c\n",
+		},
+		{
+			name: "insert at end",
+			from: "a\nb\n",
+			to:   "a\nb\nc\n",
+			want: "--- a\n+++ b\n@@ -1,2 +1,3 @@\n a\n b\n+c\n",
+		},
+		{
+			name: "delete at start",
+			from: "a\nb\nc\n",
+			to:   "b\nc\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,2 @@\n-a\n b\n c\n",
+		},
+		{
+			name: "delete at end",
+			from: "a\nb\nc\n",
+			to:   "a\nb\n",
+			want: "--- a\n+++ b\n@@ -1,3 +1,2 @@\n a\n b\n-c\n",
+		},
+		{
+			name: "missing trailing newline",
+			from: "a\nb\n",
+			to:   "a\nb",
+			want: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n+b\n\\ No newline at end of file\n",
+		},
+		{
+			name: "add trailing newline",
+			from: "a\nb",
+			to:   "a\nb\n",
+			want: "--- a\n+++ b\n@@ -1,2 +1,2 @@\n a\n-b\n\\ No newline at end of file\n+b\n",
+		},
+		{
+			name: "empty to content",
+			from: "",
+			to:   "a\n",
+			want: "--- a\n+++ b\n@@ -0,0 +1 @@\n+a\n",
+		},
+		{
+			name: "hunks separated by 2*context lines",
+			from: "x\n1\n2\n3\n4\n5\n6\ny\n",
+			to:   "X\n1\n2\n3\n4\n5\n6\nY\n",
+			want: "--- a\n+++ b\n@@ -1,8 +1,8 @@\n-x\n+X\n 1\n 2\n 3\n 4\n 5\n 6\n-y\n+Y\n",
+		},
+		{
+			name: "hunks separated by 2*context+1 lines",
+			from: "x\n1\n2\n3\n4\n5\n6\n7\ny\n",
+			to:   "X\n1\n2\n3\n4\n5\n6\n7\nY\n",
+			want: "--- a\n+++ b\n@@ -1,4 +1,4 @@\n-x\n+X\n 1\n 2\n 3\n@@ -6,4 +6,4 @@\n 5\n 6\n 7\n-y\n+Y\n",
+		},
+		{
+			name: "change in the middle",
+			from: "1\n2\n3\n4\na\n5\n6\n7\n8\n",
+			to:   "1\n2\n3\n4\nb\n5\n6\n7\n8\n",
+			want: "--- a\n+++ b\n@@ -2,7 +2,7 @@\n 2\n 3\n 4\n-a\n+b\n 5\n 6\n 7\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := unifiedDiff("a", "b", []byte(tt.from), []byte(tt.to)); got != tt.want {
+				t.Errorf("unifiedDiff() =\n%s\nwant\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+// Edit script must turn one content into the other with the fewest changes, which is checked against the length of
+// longest common subsequence.
+func TestDiffLinesMinimal(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	randomLines := func() (res []string) {
+		for i := r.Intn(30); i > 0; i-- {
+			res = append(res, string(rune('a'+r.Intn(4))))
+		}
+		return
+	}
+	for i := 0; i < 500; i++ {
+		a, b := randomLines(), randomLines()
+		var from, to []string
+		common := 0
+		for _, l := range diffLines(a, b) {
+			if l.kind != '+' {
+				from = append(from, l.text)
+			}
+			if l.kind != '-' {
+				to = append(to, l.text)
+			}
+			if l.kind == ' ' {
+				common++
+			}
+		}
+		if strings.Join(from, ",") != strings.Join(a, ",") || strings.Join(to, ",") != strings.Join(b, ",") {
+			t.Fatalf("diffLines(%v, %v) does not reproduce the inputs", a, b)
+		}
+		if want := lcsLength(a, b); common != want {
+			t.Fatalf("diffLines(%v, %v) keeps %d lines, want %d", a, b, common, want)
+		}
+	}
+}
+
+func lcsLength(a []string, b []string) int {
+	dp := make([][]int, len(a)+1)
+	for i := range dp {
+		dp[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			switch {
+			case a[i] == b[j]:
+				dp[i][j] = dp[i+1][j+1] + 1
+			case dp[i+1][j] > dp[i][j+1]:
+				dp[i][j] = dp[i+1][j]
+			default:
+				dp[i][j] = dp[i][j+1]
+			}
+		}
+	}
+	return dp[0][0]
+}
@@ -0,0 +1,41 @@
+package pbthrift
+
+import (
+	"fmt"
+	"io"
+)
+
+// Convert files in memory and write a plan to w without writing any file, each line contains the status of an output
+// file compared with the file on disk, i.e. created, changed, unchanged or refused, its input path and output path.
+func (r *Runner) DryRun(w io.Writer) (err error) {
+	if r.Config.Task != TASK_FILE_PROTO2THRIFT && r.Config.Task != TASK_FILE_THRIFT2PROTO {
+		return &OptionError{Option: "dry-run", Value: "true", Reason: "it requires input file"}
+	}
+	var files []GeneratedFile
+	if files, err = r.PipeAll(); err != nil {
+		return
+	}
+
+	counts := map[string]int{}
+	for _, file := range files {
+		var status string
+		if _, status, err = compareWithDisk(file, r.Config.Force); err != nil {
+			return
+		}
+		counts[status]++
+		source := file.Source
+		if source == "" {
+			source = "(generated)"
+		}
+		if _, err = fmt.Fprintf(w, "%-9s %s => %s\n", status, source, file.Path); err != nil {
+			return
+		}
+	}
+	summary := fmt.Sprintf("%d files: %d created, %d changed, %d unchanged",
+		len(files), counts[StatusCreated], counts[StatusChanged], counts[StatusUnchanged])
+	if counts[StatusRefused] > 0 {
+		summary += fmt.Sprintf(", %d refused", counts[StatusRefused])
+	}
+	_, err = fmt.Fprintln(w, summary)
+	return
+}
@@ -0,0 +1,107 @@
+package pbthrift
+
+import (
+	"bytes"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Return content of files in the dir by slash separated paths relative to it.
+func readFiles(t *testing.T, dir string) (res map[string]string) {
+	t.Helper()
+	res = map[string]string{}
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		content, err := os.ReadFile(path)
+		rel, _ := filepath.Rel(dir, path)
+		res[filepath.ToSlash(rel)] = string(content)
+		return err
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return
+}
+
+func TestDryRun(t *testing.T) {
+	input := map[string]string{
+		"a.proto": "syntax = \"proto3\";\npackage a;\nmessage A {\n\tstring id = 1;\n}\n",
+		"b.proto": "syntax = \"proto3\";\npackage b;\nmessage B {\n\tstring id = 1;\n}\n",
+		"c.proto": "syntax = \"proto3\";\npackage c;\nmessage C {\n\tstring id = 1;\n}\n",
+		"d.proto": "syntax = \"proto3\";\npackage d;\nmessage D {\n\tstring id = 1;\n}\n",
+	}
+	cases := []struct {
+		name  string
+		force bool
+		want  string
+	}{
+		{
+			name: "hand-written file is refused",
+			want: `unchanged INPUT/a.proto => OUTPUT/a.thrift
+refused   INPUT/b.proto => OUTPUT/b.thrift
+changed   INPUT/c.proto => OUTPUT/c.thrift
+created   INPUT/d.proto => OUTPUT/d.thrift
+4 files: 1 created, 1 changed, 1 unchanged, 1 refused
+`,
+		},
+		{
+			name:  "hand-written file is changed by force",
+			force: true,
+			want: `unchanged INPUT/a.proto => OUTPUT/a.thrift
+changed   INPUT/b.proto => OUTPUT/b.thrift
+changed   INPUT/c.proto => OUTPUT/c.thrift
+created   INPUT/d.proto => OUTPUT/d.thrift
+4 files: 1 created, 2 changed, 1 unchanged
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			inputDir, outputDir := t.TempDir(), t.TempDir()
+			writeFiles(t, inputDir, input)
+			config := RunnerConfig{
+				Task:      TASK_FILE_PROTO2THRIFT,
+				InputPath: inputDir,
+				OutputDir: outputDir,
+				Force:     c.force,
+			}
+			r, err := NewRunnerWithConfig(config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err = r.Run(); err != nil {
+				t.Fatal(err)
+			}
+			// b.thrift is written by hand, c.thrift is generated from an older c.proto, d.thrift is not generated yet
+			if err = os.WriteFile(filepath.Join(outputDir, "b.thrift"), []byte("struct B {\n}\n"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			writeFiles(t, inputDir, map[string]string{"c.proto": input["c.proto"] + "message E {\n}\n"})
+			if err = os.Remove(filepath.Join(outputDir, "d.thrift")); err != nil {
+				t.Fatal(err)
+			}
+			before := readFiles(t, outputDir)
+
+			var buf bytes.Buffer
+			if r, err = NewRunnerWithConfig(config); err != nil {
+				t.Fatal(err)
+			}
+			if err = r.DryRun(&buf); err != nil {
+				t.Fatal(err)
+			}
+			got := strings.NewReplacer(inputDir, "INPUT", outputDir, "OUTPUT").Replace(buf.String())
+			if got != c.want {
+				t.Errorf("plan =\n%s\nwant\n%s", got, c.want)
+			}
+			if after := readFiles(t, outputDir); !reflect.DeepEqual(after, before) {
+				t.Errorf("files are written by dry run")
+			}
+		})
+	}
+}
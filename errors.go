@@ -0,0 +1,100 @@
+package pbthrift
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"strings"
+)
+
+// Errors returned by Runner and Generator, use errors.Is to check the kind of returned error.
+var (
+	ErrInvalidOption  = errors.New("invalid option")
+	ErrFileNotFound   = errors.New("file not found")
+	ErrCyclicInclude  = errors.New("cyclic include")
+	ErrNoSubGenerator = errors.New("sub generator not found")
+	ErrInvalidIdl     = errors.New("invalid idl")
+	ErrOutOfDate      = errors.New("generated files out of date")
+	ErrNotGenerated   = errors.New("file is not generated by protobuf-thrift, use force option to overwrite it")
+	ErrOutputConflict = errors.New("different files are converted to the same output path")
+)
+
+// Error for invalid option value specified by user
+type OptionError struct {
+	Option string // option name, same as the flag name
+	Value  string
+	Reason string
+}
+
+func (e *OptionError) Error() string {
+	return fmt.Sprintf("invalid %s option %q, %s", e.Option, e.Value, e.Reason)
+}
+
+func (e *OptionError) Is(target error) bool {
+	return target == ErrInvalidOption
+}
+
+// Error occurred when handling an idl file, wrapping the underlying error
+type FileError struct {
+	Op   string // operation on the file, e.g. open, parse, generate
+	Path string // absolute path for the file
+	Err  error
+}
+
+func (e *FileError) Error() string {
+	return fmt.Sprintf("%s %s: %v", e.Op, e.Path, e.Err)
+}
+
+func (e *FileError) Unwrap() error {
+	return e.Err
+}
+
+// Wrap error of the operation on the file into FileError, missing file is reported as ErrFileNotFound.
+func fileError(op string, path string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		err = ErrFileNotFound
+	}
+	return &FileError{Op: op, Path: path, Err: err}
+}
+
+// Error for include cycle found in recursive mode
+type CycleError struct {
+	// every cycle found, each one is absolute paths for files in the cycle, starting and ending with the same file
+	Paths [][]string
+}
+
+func (e *CycleError) Error() string {
+	cycles := []string{}
+	for _, path := range e.Paths {
+		cycles = append(cycles, strings.Join(path, " -> "))
+	}
+	if len(cycles) == 1 {
+		return fmt.Sprintf("cyclic include found: %s", cycles[0])
+	}
+	return fmt.Sprintf("%d cyclic includes found: %s", len(cycles), strings.Join(cycles, "; "))
+}
+
+func (e *CycleError) Is(target error) bool {
+	return target == ErrCyclicInclude
+}
+
+// Error for generated files differing from converted result in check mode
+type CheckError struct {
+	Paths   []string // output paths relative to output dir, sorted
+	Refused []string // output paths of existing files without generated header, which are not overwritten unless forced
+}
+
+func (e *CheckError) Error() string {
+	var msgs []string
+	if len(e.Paths) > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d generated files out of date: %s", len(e.Paths), strings.Join(e.Paths, ", ")))
+	}
+	if len(e.Refused) > 0 {
+		msgs = append(msgs, fmt.Sprintf("%d files not generated by protobuf-thrift: %s", len(e.Refused), strings.Join(e.Refused, ", ")))
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (e *CheckError) Is(target error) bool {
+	return target == ErrOutOfDate || (target == ErrNotGenerated && len(e.Refused) > 0)
+}
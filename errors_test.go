@@ -0,0 +1,52 @@
+package pbthrift
+
+import (
+	"errors"
+	"testing"
+	"testing/fstest"
+)
+
+func TestErrors(t *testing.T) {
+	fsys := fstest.MapFS{
+		"idl/bad.proto":     {Data: []byte("syntax = \"proto3\";\nmessage A {\n")},
+		"idl/bad.thrift":    {Data: []byte("struct A {\n\t1: i32\n")},
+		"idl/missing.proto": {Data: []byte("syntax = \"proto3\";\nimport \"none.proto\";\n")},
+		"idl/a.thrift":      {Data: []byte("include \"b.thrift\"\nstruct A {\n\t1: b.B b\n}\n")},
+		"idl/b.thrift":      {Data: []byte("include \"a.thrift\"\nstruct B {\n\t1: a.A a\n}\n")},
+	}
+	cases := []struct {
+		name   string
+		config RunnerConfig
+		want   error
+	}{
+		{"missing input", RunnerConfig{Task: TASK_FILE_PROTO2THRIFT, InputPath: "idl/none.proto"}, ErrFileNotFound},
+		{"missing include", RunnerConfig{Task: TASK_FILE_PROTO2THRIFT, InputPath: "idl/missing.proto", Recursive: true}, ErrFileNotFound},
+		{"invalid proto", RunnerConfig{Task: TASK_FILE_PROTO2THRIFT, InputPath: "idl/bad.proto"}, ErrInvalidIdl},
+		{"invalid thrift", RunnerConfig{Task: TASK_FILE_THRIFT2PROTO, InputPath: "idl/bad.thrift"}, ErrInvalidIdl},
+		{"invalid proto content", RunnerConfig{Task: TASK_CONTENT_PROTO2THRIFT, RawContent: "message A {", Pipe: true}, ErrInvalidIdl},
+		{"invalid thrift content", RunnerConfig{Task: TASK_CONTENT_THRIFT2PROTO, RawContent: "struct A {", Pipe: true}, ErrInvalidIdl},
+		{"cyclic include", RunnerConfig{Task: TASK_FILE_THRIFT2PROTO, InputPath: "idl/a.thrift", Recursive: true}, ErrCyclicInclude},
+		{"invalid option", RunnerConfig{Task: TASK_FILE_PROTO2THRIFT, InputPath: "idl/bad.proto", NameCase: "kebab"}, ErrInvalidOption},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			c.config.FS = fsys
+			c.config.OutputDir = "/out"
+			r, err := NewRunnerWithConfig(c.config)
+			if err == nil {
+				if c.config.Pipe {
+					_, err = r.Pipe()
+				} else {
+					_, err = r.PipeAll()
+				}
+			}
+			if !errors.Is(err, c.want) {
+				t.Fatalf("err = %v, want %v", err, c.want)
+			}
+			var fileErr *FileError
+			if (c.want == ErrFileNotFound || c.want == ErrInvalidIdl) && !errors.As(err, &fileErr) {
+				t.Errorf("err = %T, want FileError", err)
+			}
+		})
+	}
+}
@@ -1,12 +1,18 @@
 package main
 
 import (
+	"errors"
+	"flag"
+
 	pbThrift "github.com/YYCoder/protobuf-thrift"
 	"github.com/YYCoder/protobuf-thrift/utils/logger"
 )
 
 func main() {
 	runner, err := pbThrift.NewRunner()
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	}
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -14,6 +20,9 @@ func main() {
 	logger.Info("Convert started, please wait.")
 
 	err = runner.Run()
+	if closeErr := runner.Close(); err == nil {
+		err = closeErr
+	}
 	if err != nil {
 		logger.Fatal(err)
 	}
@@ -0,0 +1,51 @@
+package pbthrift
+
+import (
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Input files are read from OS file system by absolute paths if fsys is nil. Otherwise, they are read from fsys, and
+// absolute paths are rooted at the root of fsys, e.g. /api/user.proto => api/user.proto, so that path handling for
+// includes and imports works the same way for both.
+
+// Convert absolute path to the path in fsys.
+func fsPath(absPath string) string {
+	res := strings.TrimPrefix(path.Clean(filepath.ToSlash(absPath)), "/")
+	if res == "" {
+		return "."
+	}
+	return res
+}
+
+// Return absolute path rooted at the root of fsys for path, which is relative to the root.
+func fsAbsPath(p string) string {
+	return filepath.FromSlash(path.Join("/", filepath.ToSlash(p)))
+}
+
+func openFile(fsys fs.FS, absPath string) (fs.File, error) {
+	if fsys == nil {
+		return os.Open(absPath)
+	}
+	return fsys.Open(fsPath(absPath))
+}
+
+func statFile(fsys fs.FS, absPath string) (fs.FileInfo, error) {
+	if fsys == nil {
+		return os.Stat(absPath)
+	}
+	return fs.Stat(fsys, fsPath(absPath))
+}
+
+// Walk the file tree rooted at root, paths passed to fn are absolute.
+func walkDir(fsys fs.FS, root string, fn fs.WalkDirFunc) error {
+	if fsys == nil {
+		return filepath.WalkDir(root, fn)
+	}
+	return fs.WalkDir(fsys, fsPath(root), func(p string, d fs.DirEntry, err error) error {
+		return fn(fsAbsPath(p), d, err)
+	})
+}
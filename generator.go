@@ -1,10 +1,16 @@
 package pbthrift
 
 import (
+	"errors"
+	"fmt"
+	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/YYCoder/protobuf-thrift/utils/logger"
 )
@@ -13,12 +19,79 @@ import (
 type FileInfo struct {
 	absPath    string // absolute path for this included file
 	outputPath string // absolute path for the output file
+	includedBy string // absolute path for the file including this file, empty for input files
+}
+
+// Thrift annotation marking a flattened nested type with its enclosing struct and original name, e.g.
+// struct OuterInner {} (pbthrift.nested = "Outer.Inner")
+const nestedAnnotation = "pbthrift.nested"
+
+// Return the string for one indent level.
+func indentUnit(useSpaceIndent bool, indentSpace string) string {
+	if !useSpaceIndent {
+		return "\t"
+	}
+	spaceCount, _ := strconv.Atoi(indentSpace)
+	return strings.Repeat(" ", spaceCount)
+}
+
+// Join type name with its scope, e.g. Outer + Inner => Outer.Inner.
+func joinTypePath(scope string, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+// Search path in import paths in order, return absolute path of the first existing file and the matched import path.
+func findInImportPaths(fsys fs.FS, importPaths []string, path string) (absPath string, importPath string, found bool) {
+	if filepath.IsAbs(path) {
+		return
+	}
+	for _, importPath = range importPaths {
+		absPath = filepath.Join(importPath, path)
+		if fileExists(fsys, absPath) {
+			found = true
+			return
+		}
+	}
+	return "", "", false
+}
+
+// Return the path used in generated import or include declaration, which is relative to import root. If import root is
+// not specified or the output file is outside of it, return the fallback path instead.
+func importPathFromRoot(importRoot string, outputPath string, fallback string) (res string) {
+	if importRoot == "" {
+		return fallback
+	}
+	rel, err := filepath.Rel(importRoot, outputPath)
+	if err != nil || strings.HasPrefix(rel, "..") {
+		logger.Warnf("output file %v is outside of import root %v, use %v instead", outputPath, importRoot, fallback)
+		return fallback
+	}
+	return filepath.ToSlash(rel)
+}
+
+func fileExists(fsys fs.FS, path string) bool {
+	stat, err := statFile(fsys, path)
+	return err == nil && !stat.IsDir()
+}
+
+// Return path relative to the first import path containing it.
+func relToImportPaths(importPaths []string, absPath string) (relPath string, found bool) {
+	for _, importPath := range importPaths {
+		rel, err := filepath.Rel(importPath, absPath)
+		if err != nil || strings.HasPrefix(rel, "..") {
+			continue
+		}
+		return rel, true
+	}
+	return
 }
 
 // Generator for each idl file
 type SubGenerator interface {
 	Parse() (newFiles []FileInfo, err error) // return relative file path to parsed file
-	Sink() (err error)
 	Pipe() (res []byte, err error)
 	FilePath() (res string)
 }
@@ -27,26 +100,38 @@ type SubGenerator interface {
 type Generator interface {
 	Generate() (err error)
 	Pipe() (res []byte, err error)
+	PipeAll() (res []GeneratedFile, err error)
+}
+
+// Result of a converted file returned by PipeAll
+type GeneratedFile struct {
+	Path    string // absolute path for the output file, empty for raw content task
+	Source  string // absolute path for the input file, empty for raw content task and common files of include cycles
+	Content []byte
 }
 
 func NewGenerator(conf *RunnerConfig) (res Generator, err error) {
 	gen := &generator{
 		conf:            conf,
-		filesStack:      []FileInfo{},
+		pendingFiles:    []FileInfo{},
 		subGeneratorMap: make(map[string]SubGenerator),
+		fileInfos:       make(map[string]FileInfo),
+		outputPaths:     make(map[string]string),
+		dependencies:    make(map[string][]string),
 	}
 
 	if conf.Task == TASK_CONTENT_PROTO2THRIFT || conf.Task == TASK_CONTENT_THRIFT2PROTO {
 		err = gen.initSubGeneratorForRawContent()
 	} else {
-		_, filename := filepath.Split(conf.InputPath)
-
-		gen.initSubGenerator([]FileInfo{
-			{
-				absPath:    gen.conf.InputPath,
-				outputPath: filepath.Join(gen.conf.OutputDir, gen.replaceExt(filename)),
-			},
-		})
+		// all inputs share the same files, so that files imported by several inputs are converted once
+		files := []FileInfo{}
+		for _, inputPath := range conf.inputPaths() {
+			files = append(files, gen.inputFileInfo(inputPath))
+		}
+		err = gen.initSubGenerator(files)
+	}
+	if err != nil {
+		return
 	}
 
 	res = gen
@@ -55,52 +140,333 @@ func NewGenerator(conf *RunnerConfig) (res Generator, err error) {
 
 type generator struct {
 	conf *RunnerConfig
-	// stack is empty when there is no file need to be generated, eash one is an abs file path. For rawContent task, use a default name
-	filesStack      []FileInfo
+	// files found but not parsed yet, empty when there is no file need to be generated. For rawContent task, use a default name
+	pendingFiles []FileInfo
+	// only modified by the goroutine calling parse, workers parsing files just return their results
 	subGeneratorMap map[string]SubGenerator
+	fileInfos       map[string]FileInfo // absolute path => file info, for all files need to be converted
+	outputPaths     map[string]string   // output path => absolute path of the file converted to it
+	dependencies    map[string][]string // absolute path => absolute paths of files included by it, only for recursive task
+	cache           *cache              // not nil if unchanged files are skipped by Generate, it may be set by watch mode
+
+	ignoreRuleMap map[string][]ignoreRule // absolute path of dir => patterns of ignore files in it, loaded lazily
+	cycles        map[string]*cycleInfo   // absolute path => broken include cycle containing it, set after parsing
 }
 
 func (g *generator) Generate() (err error) {
-	for len(g.filesStack) > 0 {
-		var lastFilePath FileInfo
-		lastFilePath, g.filesStack = g.filesStack[len(g.filesStack)-1], g.filesStack[:len(g.filesStack)-1]
-		sub, ok := g.subGeneratorMap[lastFilePath.absPath]
-		if !ok {
-			logger.Fatalf("Can't find file %v's sub generator", lastFilePath)
+	if g.cache == nil && g.conf.Cache && g.conf.Task != TASK_CONTENT_PROTO2THRIFT && g.conf.Task != TASK_CONTENT_THRIFT2PROTO {
+		if g.conf.Sink != nil {
+			logger.Warn("cache is only available when files are written into output dir, ignore it")
+		} else {
+			g.cache = newCache(g.conf)
+		}
+	}
+	if err = g.parse(); err != nil {
+		return
+	}
+
+	sink := g.conf.Sink
+	if sink == nil && g.conf.OutputDir != "" {
+		dirSink := NewDirSink(g.conf.OutputDir)
+		dirSink.Force = g.conf.Force
+		sink = dirSink
+	} else if sink == nil {
+		sink = NewStdoutSink()
+	}
+	// files in dir are written concurrently, other sinks, e.g. archive or stdout, are written in order to keep the
+	// result stable
+	concurrency := 1
+	if _, ok := sink.(*DirSink); ok {
+		concurrency = g.conf.Concurrency
+	}
+	paths := g.order()
+	errs := make([]error, len(paths))
+	runConcurrently(len(paths), concurrency, func(i int) {
+		// stop at the first error when writing in order
+		if concurrency <= 1 && i > 0 && errs[i-1] != nil {
+			errs[i] = errs[i-1]
 			return
 		}
+		sub := g.subGeneratorMap[paths[i]]
+		content, err := g.pipe(paths[i])
+		if err == nil {
+			err = sink.WriteFile(g.sinkPath(g.fileInfos[paths[i]].outputPath), content)
+		}
+		if err != nil {
+			errs[i] = &FileError{Op: "generate", Path: sub.FilePath(), Err: err}
+		}
+	})
+	written := []string{}
+	for i, path := range paths {
+		if errs[i] != nil {
+			return errs[i]
+		}
+		written = append(written, g.sinkPath(g.fileInfos[path].outputPath))
+	}
+	if g.cache != nil {
+		if err = g.saveCache(paths); err != nil {
+			return
+		}
+	}
+	if g.conf.Summary != nil && g.conf.Task != TASK_CONTENT_PROTO2THRIFT && g.conf.Task != TASK_CONTENT_THRIFT2PROTO {
+		err = writeSummary(g.conf.Summary, written)
+	}
+	return
+}
 
-		var newFiles []FileInfo
-		if newFiles, err = sub.Parse(); err != nil {
-			logger.Fatalf("Error occurred when parsing file %v", sub.FilePath())
+// Report or delete stale outputs, then write the cache manifest. Common files of include cycles are recorded here,
+// since they are not parsed from input files.
+func (g *generator) saveCache(paths []string) (err error) {
+	for _, path := range paths {
+		if _, found := g.cache.next.Files[path]; !found {
+			g.cache.record(g.fileInfos[path], g.sinkPath(g.fileInfos[path].outputPath), nil)
+		}
+	}
+	for _, path := range g.cache.staleFiles() {
+		output := g.cache.previous.Files[path].Output
+		if !g.conf.DeleteStale {
+			logger.Warnf("stale output %v, its input file is not converted any more, use -delete-stale to delete it", output)
+			g.cache.keepStale(path)
+			continue
+		}
+		outputPath := filepath.Join(g.conf.OutputDir, filepath.FromSlash(output))
+		if content, readErr := os.ReadFile(outputPath); readErr == nil && !isGenerated(content) && !g.conf.Force {
+			logger.Warnf("stale output %v is not generated by protobuf-thrift, use -force to delete it", output)
+			g.cache.keepStale(path)
+			continue
+		}
+		if err = os.Remove(outputPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return &FileError{Op: "delete", Path: output, Err: err}
+		}
+		logger.Infof("stale output %v deleted", output)
+	}
+	if err = g.cache.save(); err != nil {
+		err = &FileError{Op: "write", Path: filepath.Join(g.conf.OutputDir, CacheManifestName), Err: err}
+	}
+	return
+}
+
+// Return absolute paths of all files to convert in a stable order, each file comes after the files included by it, and
+// files not depending on each other are ordered by path.
+func (g *generator) order() (res []string) {
+	paths := []string{}
+	for path := range g.subGeneratorMap {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	visited := map[string]bool{}
+	var visit func(path string)
+	visit = func(path string) {
+		if visited[path] {
 			return
-		} else if len(newFiles) > 0 && g.conf.Recursive {
-			err = g.initSubGenerator(newFiles)
-			if err != nil {
-				logger.Fatalf("Error occurred when initSubGenerator file %v, %v", sub.FilePath(), err)
+		}
+		visited[path] = true
+		dependencies := append([]string{}, g.dependencies[path]...)
+		sort.Strings(dependencies)
+		for _, dependency := range dependencies {
+			if _, ok := g.subGeneratorMap[dependency]; ok {
+				visit(dependency)
+			}
+		}
+		res = append(res, path)
+	}
+	for _, path := range paths {
+		visit(path)
+	}
+	return
+}
+
+// Write paths of written files sorted, without timestamps or absolute paths, so that it can be compared between runs.
+func writeSummary(w io.Writer, paths []string) (err error) {
+	paths = append([]string{}, paths...)
+	sort.Strings(paths)
+	var summary strings.Builder
+	summary.WriteString(fmt.Sprintf("%d files written:\n", len(paths)))
+	for _, path := range paths {
+		summary.WriteString(fmt.Sprintf("%s\n", path))
+	}
+	_, err = io.WriteString(w, summary.String())
+	return
+}
+
+// Return output path relative to output dir, which is the path passed to Sink.
+func (g *generator) sinkPath(outputPath string) string {
+	if outputPath == "" || g.conf.OutputDir == "" {
+		return filepath.ToSlash(outputPath)
+	}
+	rel, err := filepath.Rel(g.conf.OutputDir, outputPath)
+	if err != nil {
+		return filepath.ToSlash(outputPath)
+	}
+	return filepath.ToSlash(rel)
+}
+
+// Parse all files, including files imported by them in recursive mode. Files are parsed level by level, files found
+// in one level are parsed concurrently, and results are merged in the order of the level, so that the result doesn't
+// depend on concurrency.
+func (g *generator) parse() (err error) {
+	for len(g.pendingFiles) > 0 {
+		var files []FileInfo
+		files, g.pendingFiles = g.pendingFiles, nil
+		if err = g.parseFiles(files); err != nil {
+			return
+		}
+	}
+
+	if g.conf.Recursive {
+		err = g.handleCycles()
+	}
+	return
+}
+
+// Result of parsing a single file by a worker, sub is nil if the file is skipped by cache
+type parseResult struct {
+	sub      SubGenerator
+	newFiles []FileInfo
+	err      error
+}
+
+// Parse files by at most Concurrency workers, then add their SubGenerator and files included by them in order. If
+// several files fail, the error of the first one is returned.
+func (g *generator) parseFiles(files []FileInfo) (err error) {
+	results := make([]parseResult, len(files))
+	runConcurrently(len(files), g.conf.Concurrency, func(i int) {
+		results[i] = g.parseFile(files[i])
+	})
+
+	for i, res := range results {
+		if res.err != nil {
+			return res.err
+		}
+		path := files[i].absPath
+		if res.sub != nil {
+			g.subGeneratorMap[path] = res.sub
+		} else {
+			logger.Infof("%v is not changed since the last run, skip it", path)
+		}
+		if g.cache != nil {
+			g.cache.record(files[i], g.sinkPath(files[i].outputPath), res.newFiles)
+		}
+		if len(res.newFiles) > 0 && g.conf.Recursive {
+			for _, file := range res.newFiles {
+				g.dependencies[path] = append(g.dependencies[path], file.absPath)
+			}
+			if err = g.initSubGenerator(res.newFiles); err != nil {
 				return
 			}
 		}
 	}
+	return
+}
 
-	for _, sub := range g.subGeneratorMap {
-		if err = sub.Sink(); err != nil {
-			logger.Fatalf("Error occurred when generating file %v", sub.FilePath(), err)
+// Parse single file, it only reads the file and the files included by it, so it's safe to be called concurrently.
+func (g *generator) parseFile(file FileInfo) (res parseResult) {
+	// parsers may panic on malformed idl, which should not stop other files or watch mode
+	defer func() {
+		if r := recover(); r != nil {
+			res = parseResult{err: &FileError{Op: "parse", Path: file.absPath, Err: fmt.Errorf("%w: %v", ErrInvalidIdl, r)}}
+		}
+	}()
+	if g.cache != nil {
+		var skipped bool
+		if res.newFiles, skipped = g.cache.lookup(file); skipped {
+			return
+		}
+	}
+	// SubGenerator for raw content is created before parsing
+	sub, ok := g.subGeneratorMap[file.absPath]
+	if !ok {
+		if sub, res.err = g.newSubGenerator(file, nil); res.err != nil {
+			res.err = fileError("parse", file.absPath, res.err)
 			return
 		}
 	}
+	if sub == nil {
+		res.err = &FileError{Op: "generate", Path: file.absPath, Err: ErrNoSubGenerator}
+		return
+	}
+	res.sub = sub
+	if res.newFiles, res.err = sub.Parse(); res.err != nil {
+		res.err = &FileError{Op: "parse", Path: sub.FilePath(), Err: res.err}
+	}
+	return
+}
+
+// Call fn with each index in [0, n) by at most concurrency goroutines, fn is called in order when concurrency is 1.
+func runConcurrently(n int, concurrency int, fn func(i int)) {
+	if concurrency <= 1 || n <= 1 {
+		for i := 0; i < n; i++ {
+			fn(i)
+		}
+		return
+	}
+	var wg sync.WaitGroup
+	workers := make(chan struct{}, concurrency)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		workers <- struct{}{}
+		go func(i int) {
+			defer func() {
+				<-workers
+				wg.Done()
+			}()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// Return all converted files without writing them, sorted by output path. It supports recursive and directory
+// transform as Generate does.
+func (g *generator) PipeAll() (res []GeneratedFile, err error) {
+	if err = g.parse(); err != nil {
+		return
+	}
+
+	for _, path := range g.order() {
+		sub := g.subGeneratorMap[path]
+		var content []byte
+		if content, err = g.pipe(path); err != nil {
+			err = &FileError{Op: "generate", Path: sub.FilePath(), Err: err}
+			return
+		}
+		file := GeneratedFile{
+			Path:    g.fileInfos[path].outputPath,
+			Content: content,
+		}
+		if _, isCommon := sub.(*commonGenerator); !isCommon && g.fileInfos[path].absPath != "" {
+			file.Source = path
+		}
+		res = append(res, file)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Path < res[j].Path
+	})
 	return
 }
 
-// Pipe the transformed result to return value, since the scenario for Pipe is using protobuf-thrift as a lib, currently not support recursive transform.
+// Pipe the transformed result of the input file to return value, use PipeAll for recursive or directory transform.
 func (g *generator) Pipe() (res []byte, err error) {
-	for _, sub := range g.subGeneratorMap {
-		if _, err = sub.Parse(); err != nil {
-			logger.Fatalf("Error occurred when parsing file %v", sub.FilePath())
+	// only input files are parsed, files included by them are not followed
+	files := g.pendingFiles
+	g.pendingFiles = nil
+	results := make([]parseResult, len(files))
+	runConcurrently(len(files), g.conf.Concurrency, func(i int) {
+		results[i] = g.parseFile(files[i])
+	})
+	for i, r := range results {
+		if r.err != nil {
+			err = r.err
 			return
 		}
-		if res, err = sub.Pipe(); err != nil {
-			logger.Fatalf("Error occurred when generating file %v", sub.FilePath(), err)
+		g.subGeneratorMap[files[i].absPath] = r.sub
+	}
+
+	for _, path := range g.order() {
+		sub := g.subGeneratorMap[path]
+		if res, err = g.pipe(path); err != nil {
+			err = &FileError{Op: "generate", Path: sub.FilePath(), Err: err}
 			return
 		}
 		break
@@ -133,21 +499,33 @@ func (g *generator) replaceExt(filename string) (res string) {
 	return
 }
 
-// get all absolute file paths from single dir
+// get all absolute file paths from single input dir
 func (g *generator) getAllFileFromDir(root string) (res []FileInfo, err error) {
-	filepath.Walk(root, func(path string, info fs.FileInfo, err error) error {
+	inputRoot := g.conf.inputRoot(root)
+	walkDir(g.conf.FS, root, func(path string, d fs.DirEntry, err error) error {
 		var absPath string
 		if filepath.IsAbs(path) {
 			absPath = path
 		} else {
 			absPath = filepath.Join(root, path)
 		}
+		if d != nil && d.IsDir() && absPath != root && g.ignored(absPath, true) {
+			logger.Infof("skip ignored dir %v", absPath)
+			return fs.SkipDir
+		}
 		isIdl, _ := g.absPathIsIdl(absPath)
-		if isIdl {
-			relPath, err := filepath.Rel(root, absPath)
-			if err != nil {
-				logger.Errorf("filepath.Rel %v %v, err %v", root, path, err)
-				return nil
+		if isIdl && g.ignored(absPath, false) {
+			logger.Infof("skip ignored file %v", absPath)
+		} else if isIdl {
+			// keep output path relative to the import path containing it like input file, so that input dirs and
+			// imported files are converted to the same output tree
+			relPath, found := relToImportPaths(g.conf.ImportPaths, absPath)
+			if !found {
+				var err error
+				if relPath, err = filepath.Rel(inputRoot, absPath); err != nil {
+					logger.Errorf("filepath.Rel %v %v, err %v", inputRoot, path, err)
+					return nil
+				}
 			}
 			newFile := FileInfo{
 				absPath:    absPath,
@@ -168,34 +546,42 @@ func (g *generator) initSubGenerator(fileInfos []FileInfo) (err error) {
 	for _, fileInfo := range fileInfos {
 		filePath := fileInfo.absPath
 		if !filepath.IsAbs(filePath) {
-			logger.Fatalf("Path %v is not absolute path", filePath)
+			err = &FileError{Op: "open", Path: filePath, Err: fmt.Errorf("not absolute path")}
 			return
 		}
-		var file *os.File
-
 		// if file already exists, then pass
-		_, found := g.subGeneratorMap[filePath]
+		_, found := g.fileInfos[filePath]
 		if found {
 			continue
 		}
 
-		file, err = os.Open(filePath)
-		if err != nil {
-			logger.Errorf("Could not open file %v", filePath)
+		// included files are skipped before looking for them, so that ignored files are not required to exist
+		if fileInfo.includedBy != "" && g.ignored(filePath, false) {
+			logger.Infof("skip ignored file %v included by %v", filePath, fileInfo.includedBy)
+			continue
+		}
+
+		if fileInfo.includedBy != "" && !fileExists(g.conf.FS, filePath) {
+			includeDir := filepath.Dir(fileInfo.includedBy)
+			includePath, _ := filepath.Rel(includeDir, filePath)
+			searched := append([]string{includeDir}, g.conf.ImportPaths...)
+			err = &FileError{
+				Op:   "include",
+				Path: fileInfo.includedBy,
+				Err:  fmt.Errorf("%w, can not find %v, searched in %v", ErrFileNotFound, includePath, searched),
+			}
 			return err
 		}
-		defer file.Close()
 
+		// files are only stat here, they are opened one at a time when parsed
 		var stat fs.FileInfo
-		stat, err = file.Stat()
-		if err != nil {
-			return err
+		if stat, err = statFile(g.conf.FS, filePath); err != nil {
+			return fileError("stat", filePath, err)
 		}
 
 		if stat.IsDir() {
 			newfiles, err := g.getAllFileFromDir(filePath)
 			if err != nil {
-				logger.Errorf("getAllFileFromDir error %v", err)
 				return err
 			}
 			files = append(files, newfiles...)
@@ -210,50 +596,87 @@ func (g *generator) initSubGenerator(fileInfos []FileInfo) (err error) {
 
 	}
 
-	g.filesStack = append(g.filesStack, files...)
-
 	for _, file := range files {
-		path := file.absPath
-		outputDir, filename := filepath.Split(file.outputPath)
-
-		if g.conf.Task == TASK_FILE_PROTO2THRIFT {
-			var generator SubGenerator
-			conf := &ThriftGeneratorConfig{
-				taskType:       g.conf.Task,
-				filePath:       path,
-				fileName:       filename,
-				outputDir:      outputDir,
-				useSpaceIndent: g.conf.UseSpaceIndent,
-				indentSpace:    g.conf.IndentSpace,
-				fieldCase:      g.conf.FieldCase,
-				nameCase:       g.conf.NameCase,
-				syntax:         g.conf.Syntax,
-			}
-			generator, err = NewThriftGenerator(conf)
-			if err != nil {
-				logger.Fatalf("Initializing thrift generator error %v", err)
-				return
-			}
-			g.subGeneratorMap[path] = generator
-		} else if g.conf.Task == TASK_FILE_THRIFT2PROTO {
-			var generator SubGenerator
-			conf := &ProtoGeneratorConfig{
-				taskType:       g.conf.Task,
-				filePath:       path,
-				fileName:       filename,
-				outputDir:      outputDir,
-				useSpaceIndent: g.conf.UseSpaceIndent,
-				indentSpace:    g.conf.IndentSpace,
-				fieldCase:      g.conf.FieldCase,
-				nameCase:       g.conf.NameCase,
-				syntax:         g.conf.Syntax,
-			}
-			generator, err = NewProtoGenerator(conf)
-			if err != nil {
-				logger.Fatalf("Initializing proto generator error %v", err)
-				return
+		// the same file may be found twice, e.g. included by different files in the same level
+		if _, found := g.fileInfos[file.absPath]; found {
+			continue
+		}
+		// e.g. files with the same relative path in different input dirs
+		if other, found := g.outputPaths[file.outputPath]; found {
+			err = &FileError{
+				Op:   "convert",
+				Path: file.absPath,
+				Err:  fmt.Errorf("%w, %v is converted to %v too", ErrOutputConflict, other, file.outputPath),
 			}
-			g.subGeneratorMap[path] = generator
+			return
+		}
+		g.pendingFiles = append(g.pendingFiles, file)
+		g.fileInfos[file.absPath] = file
+		g.outputPaths[file.outputPath] = file.absPath
+	}
+	return
+}
+
+// Initialize SubGenerator for single file, cycle is not nil only when the file is in an include cycle to be broken.
+func (g *generator) newSubGenerator(file FileInfo, cycle *cycleInfo) (res SubGenerator, err error) {
+	path := file.absPath
+	outputDir, filename := filepath.Split(file.outputPath)
+	opts := g.fileOptions(path)
+	var fileOptions func(absPath string) fileOptions
+	if len(g.conf.Overrides) > 0 {
+		fileOptions = g.fileOptions
+	}
+
+	if g.conf.Task == TASK_FILE_PROTO2THRIFT {
+		conf := &ThriftGeneratorConfig{
+			TaskType:        g.conf.Task,
+			FS:              g.conf.FS,
+			FilePath:        path,
+			FileName:        filename,
+			OutputDir:       outputDir,
+			OutputRootDir:   g.conf.OutputDir,
+			ImportPaths:     g.conf.ImportPaths,
+			ImportRoot:      g.conf.ImportRoot,
+			cycle:           cycle,
+			cycleOf:         g.cycleOf,
+			fileOptions:     fileOptions,
+			SkipWeakImports: g.conf.SkipWeakImports,
+			UseSpaceIndent:  opts.useSpaceIndent,
+			IndentSpace:     opts.indentSpace,
+			FieldCase:       opts.fieldCase,
+			NameCase:        opts.nameCase,
+			NestedTypes:     opts.nestedTypes,
+			Syntax:          opts.syntax,
+		}
+		res, err = NewThriftGenerator(conf)
+		if err != nil {
+			err = &FileError{Op: "parse", Path: path, Err: err}
+			return
+		}
+	} else if g.conf.Task == TASK_FILE_THRIFT2PROTO {
+		conf := &ProtoGeneratorConfig{
+			TaskType:       g.conf.Task,
+			FS:             g.conf.FS,
+			FilePath:       path,
+			FileName:       filename,
+			OutputDir:      outputDir,
+			OutputRootDir:  g.conf.OutputDir,
+			ImportPaths:    g.conf.ImportPaths,
+			ImportRoot:     g.conf.ImportRoot,
+			cycle:          cycle,
+			cycleOf:        g.cycleOf,
+			fileOptions:    fileOptions,
+			UseSpaceIndent: opts.useSpaceIndent,
+			IndentSpace:    opts.indentSpace,
+			FieldCase:      opts.fieldCase,
+			NameCase:       opts.nameCase,
+			NestedTypes:    opts.nestedTypes,
+			Syntax:         opts.syntax,
+		}
+		res, err = NewProtoGenerator(conf)
+		if err != nil {
+			err = &FileError{Op: "parse", Path: path, Err: err}
+			return
 		}
 	}
 	return
@@ -263,43 +686,43 @@ func (g *generator) initSubGeneratorForRawContent() (err error) {
 	logger.Info("initSubGeneratorForRawContent start")
 
 	path := "raw_content"
-	g.filesStack = append(g.filesStack, FileInfo{
+	g.pendingFiles = append(g.pendingFiles, FileInfo{
 		absPath: path,
 	})
 	if g.conf.Task == TASK_CONTENT_PROTO2THRIFT {
 		var generator SubGenerator
 		conf := &ThriftGeneratorConfig{
-			taskType:       g.conf.Task,
-			rawContent:     g.conf.RawContent,
-			filePath:       path,
-			useSpaceIndent: g.conf.UseSpaceIndent,
-			indentSpace:    g.conf.IndentSpace,
-			fieldCase:      g.conf.FieldCase,
-			nameCase:       g.conf.NameCase,
-			syntax:         g.conf.Syntax,
+			TaskType:       g.conf.Task,
+			RawContent:     g.conf.RawContent,
+			FilePath:       path,
+			UseSpaceIndent: g.conf.UseSpaceIndent,
+			IndentSpace:    g.conf.IndentSpace,
+			FieldCase:      g.conf.FieldCase,
+			NameCase:       g.conf.NameCase,
+			NestedTypes:    g.conf.NestedTypes,
+			Syntax:         g.conf.Syntax,
 		}
 		generator, err = NewThriftGenerator(conf)
 		if err != nil {
-			logger.Errorf("NewThriftGenerator failed, %s", err)
-			return err
+			return &FileError{Op: "parse", Path: path, Err: err}
 		}
 		g.subGeneratorMap[path] = generator
 	} else if g.conf.Task == TASK_CONTENT_THRIFT2PROTO {
 		var generator SubGenerator
 		conf := &ProtoGeneratorConfig{
-			taskType:       g.conf.Task,
-			rawContent:     g.conf.RawContent,
-			filePath:       path,
-			useSpaceIndent: g.conf.UseSpaceIndent,
-			indentSpace:    g.conf.IndentSpace,
-			fieldCase:      g.conf.FieldCase,
-			nameCase:       g.conf.NameCase,
-			syntax:         g.conf.Syntax,
+			TaskType:       g.conf.Task,
+			RawContent:     g.conf.RawContent,
+			FilePath:       path,
+			UseSpaceIndent: g.conf.UseSpaceIndent,
+			IndentSpace:    g.conf.IndentSpace,
+			FieldCase:      g.conf.FieldCase,
+			NameCase:       g.conf.NameCase,
+			NestedTypes:    g.conf.NestedTypes,
+			Syntax:         g.conf.Syntax,
 		}
 		generator, err = NewProtoGenerator(conf)
 		if err != nil {
-			logger.Errorf("NewProtoGenerator failed, %s", err)
-			return err
+			return &FileError{Op: "parse", Path: path, Err: err}
 		}
 		g.subGeneratorMap[path] = generator
 	}
@@ -0,0 +1,59 @@
+package pbthrift
+
+import (
+	"path"
+	"strings"
+)
+
+// Report whether slash separated path matches the glob pattern, see RunnerConfig.Include for the syntax.
+func matchGlob(pattern string, name string) bool {
+	pattern = strings.Trim(pattern, "/")
+	names := strings.Split(name, "/")
+	if !strings.Contains(pattern, "/") && pattern != "**" {
+		for _, n := range names {
+			if ok, _ := path.Match(pattern, n); ok {
+				return true
+			}
+		}
+		return false
+	}
+	patterns := strings.Split(pattern, "/")
+	for i := len(names); i > 0; i-- {
+		if matchElements(patterns, names[:i]) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchElements(patterns []string, names []string) bool {
+	if len(patterns) == 0 {
+		return len(names) == 0
+	}
+	if patterns[0] == "**" {
+		for i := 0; i <= len(names); i++ {
+			if matchElements(patterns[1:], names[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(names) == 0 {
+		return false
+	}
+	ok, _ := path.Match(patterns[0], names[0])
+	return ok && matchElements(patterns[1:], names[1:])
+}
+
+// Return error if the glob pattern is malformed or empty.
+func validateGlob(option string, pattern string) (err error) {
+	if strings.Trim(pattern, "/") == "" {
+		return &OptionError{Option: option, Value: pattern, Reason: "it must not be empty"}
+	}
+	for _, p := range strings.Split(pattern, "/") {
+		if _, err = path.Match(p, ""); err != nil {
+			return &OptionError{Option: option, Value: pattern, Reason: err.Error()}
+		}
+	}
+	return
+}
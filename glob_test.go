@@ -0,0 +1,94 @@
+package pbthrift
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMatchGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		// pattern without slash matches any element
+		{"*.proto", "a.proto", true},
+		{"*.proto", "api/user/a.proto", true},
+		{"*.proto", "a.thrift", false},
+		{"vendor", "vendor/google/a.proto", true},
+		{"vendor", "api/vendor/a.proto", true},
+		{"vendor", "vendors/a.proto", false},
+		{"a?.proto", "ab.proto", true},
+		{"[ab].proto", "c.proto", false},
+		// pattern with slash matches from the beginning
+		{"google/protobuf", "google/protobuf/any.proto", true},
+		{"google/protobuf", "vendor/google/protobuf/any.proto", false},
+		{"google/protobuf", "google/protobufx/any.proto", false},
+		{"api/*.proto", "api/a.proto", true},
+		{"api/*.proto", "api/user/a.proto", false},
+		{"/api", "api/a.proto", true},
+		{"api/", "api/a.proto", true},
+		// ** matches any number of dirs
+		{"**", "a.proto", true},
+		{"**/a.proto", "a.proto", true},
+		{"**/a.proto", "x/y/a.proto", true},
+		{"legacy/**/*.thrift", "legacy/a.thrift", true},
+		{"legacy/**/*.thrift", "legacy/x/y/a.thrift", true},
+		{"legacy/**/*.thrift", "api/legacy/a.thrift", false},
+		{"legacy/**", "legacy/x/a.thrift", true},
+		{"legacy/**", "legacyx/a.thrift", false},
+	}
+	for _, c := range cases {
+		if got := matchGlob(c.pattern, c.name); got != c.want {
+			t.Errorf("matchGlob(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestMatchElements(t *testing.T) {
+	cases := []struct {
+		pattern string
+		name    string
+		want    bool
+	}{
+		{"a/b", "a/b", true},
+		{"a/b", "a/b/c", false},
+		{"a/b/c", "a/b", false},
+		{"a/*", "a/b", true},
+		{"*/b", "a/b", true},
+		{"**", "a/b/c", true},
+		{"a/**", "a", true},
+		{"a/**/c", "a/c", true},
+		{"a/**/c", "a/b/b/c", true},
+		{"a/**/c", "a/b/d", false},
+		{"**/**/c", "a/c", true},
+		{"a/**/b/**/c", "a/x/b/y/z/c", true},
+		{"a/**/b/**/c", "a/x/c", false},
+	}
+	for _, c := range cases {
+		got := matchElements(strings.Split(c.pattern, "/"), strings.Split(c.name, "/"))
+		if got != c.want {
+			t.Errorf("matchElements(%q, %q) = %v, want %v", c.pattern, c.name, got, c.want)
+		}
+	}
+}
+
+func TestValidateGlob(t *testing.T) {
+	cases := []struct {
+		pattern string
+		valid   bool
+	}{
+		{"*.proto", true},
+		{"api/**/*.proto", true},
+		{"[a-z].proto", true},
+		{"", false},
+		{"/", false},
+		{"[a-.proto", false},
+		{"api/[/a.proto", false},
+	}
+	for _, c := range cases {
+		if err := validateGlob("exclude", c.pattern); (err == nil) != c.valid {
+			t.Errorf("validateGlob(%q) = %v, want valid %v", c.pattern, err, c.valid)
+		}
+	}
+}
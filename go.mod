@@ -6,4 +6,5 @@ require (
 	github.com/YYCoder/thrifter v0.0.6
 	github.com/emicklei/proto v1.9.0
 	github.com/iancoleman/strcase v0.1.3
+	gopkg.in/yaml.v3 v3.0.1
 )
@@ -0,0 +1,86 @@
+package pbthrift
+
+import (
+	"flag"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "update golden files in testdata/golden")
+
+// Convert the example files, compare the results with golden files in testdata/golden/<name>. Run
+// `go test -run TestGolden -update` to accept changes of the output.
+func TestGolden(t *testing.T) {
+	cases := []struct {
+		name      string
+		task      int
+		input     string
+		recursive bool
+	}{
+		{"proto2thrift", TASK_FILE_PROTO2THRIFT, "proto2thrift/idl.proto", false},
+		{"thrift2proto", TASK_FILE_THRIFT2PROTO, "thrift2proto/idl.thrift", false},
+		{"dir-proto2thrift", TASK_FILE_PROTO2THRIFT, "dir-proto2thrift", false},
+		{"multiple-proto2thrift", TASK_FILE_PROTO2THRIFT, "multiple-proto2thrift/idl.proto", true},
+		{"multiple-thrift2proto", TASK_FILE_THRIFT2PROTO, "multiple-thrift2proto/idl.thrift", true},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got := pipeFiles(t, RunnerConfig{
+				FS:        os.DirFS("example"),
+				Task:      c.task,
+				InputPath: c.input,
+				OutputDir: "/out",
+				Recursive: c.recursive,
+			})
+			dir := filepath.Join("testdata", "golden", c.name)
+			if *update {
+				if err := os.RemoveAll(dir); err != nil {
+					t.Fatal(err)
+				}
+				for path, content := range got {
+					path = filepath.Join(dir, filepath.FromSlash(path))
+					if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+						t.Fatal(err)
+					}
+					if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+						t.Fatal(err)
+					}
+				}
+				return
+			}
+
+			want := map[string]string{}
+			err := fs.WalkDir(os.DirFS(dir), ".", func(path string, d fs.DirEntry, err error) error {
+				if err != nil || d.IsDir() {
+					return err
+				}
+				content, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(path)))
+				want[path] = string(content)
+				return err
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(keys(got), keys(want)) {
+				t.Errorf("converted files = %q, want %q", keys(got), keys(want))
+			}
+			for path, content := range want {
+				if got[path] != content {
+					t.Errorf("%s differs from golden file:\n%s", path, unifiedDiff("golden/"+path, "converted/"+path, []byte(content), []byte(got[path])))
+				}
+			}
+		})
+	}
+}
+
+func keys(m map[string]string) (res []string) {
+	for k := range m {
+		res = append(res, k)
+	}
+	sort.Strings(res)
+	return
+}
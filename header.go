@@ -0,0 +1,99 @@
+package pbthrift
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Header stamped on every generated file, existing files without it are not overwritten unless forced
+const (
+	generatedHeader = "// generated by protobuf-thrift from %s; DO NOT EDIT\n\n"
+	generatedMarker = "// generated by protobuf-thrift"
+)
+
+// Return whether the content starts with the header of generated files.
+func isGenerated(content []byte) bool {
+	line := content
+	if end := bytes.IndexByte(content, '\n'); end >= 0 {
+		line = content[:end]
+	}
+	return bytes.HasPrefix(line, []byte(generatedMarker)) && bytes.Contains(line, []byte("DO NOT EDIT"))
+}
+
+// Drop the generated header leading the schema lowered from a generated file, otherwise converting it back stacks the
+// header of the input under the header of the output.
+func stripGeneratedHeader(s *Schema) {
+	if len(s.Elements) == 0 {
+		return
+	}
+	first := s.Elements[0]
+	if c, ok := first.(*Comment); ok {
+		if isGeneratedComment(c) {
+			s.Elements = s.Elements[1:]
+		}
+		return
+	}
+	if t := triviaOf(first); t != nil && len(t.Comments) > 0 && isGeneratedComment(t.Comments[0]) {
+		t.Comments = t.Comments[1:]
+		if len(t.Comments) > 0 {
+			t.Comments[0].Blank = 0
+		} else {
+			t.Blank = 0
+		}
+	}
+}
+
+// Return whether the comment is the header of generated files.
+func isGeneratedComment(c *Comment) bool {
+	return !c.Block && len(c.Lines) == 1 && isGenerated([]byte("// "+strings.TrimSpace(c.Lines[0])))
+}
+
+// Return converted content of the file stamped with generated header, content of raw content task is not stamped,
+// since it's not written as a file.
+func (g *generator) pipe(path string) (res []byte, err error) {
+	sub := g.subGeneratorMap[path]
+	if res, err = sub.Pipe(); err != nil || g.conf.Task == TASK_CONTENT_PROTO2THRIFT || g.conf.Task == TASK_CONTENT_THRIFT2PROTO {
+		return
+	}
+	sources := []string{path}
+	if common, ok := sub.(*commonGenerator); ok {
+		sources = common.cycle.members
+	}
+	names := []string{}
+	for _, source := range sources {
+		names = append(names, g.sourceName(source))
+	}
+	header := fmt.Sprintf(generatedHeader, strings.Join(names, ", "))
+	res = append([]byte(header), res...)
+	return
+}
+
+// Return path of the input file used in generated header, it's relative to the matched import path or input dir, so
+// that the header is the same on every machine.
+func (g *generator) sourceName(absPath string) string {
+	if root := g.sourceRoot(absPath); root != "" {
+		if rel, err := filepath.Rel(root, absPath); err == nil {
+			return filepath.ToSlash(rel)
+		}
+	}
+	return filepath.Base(absPath)
+}
+
+// Return the first import path containing the input file, or the first input root if none of them contains it, see
+// RunnerConfig.inputRoot. Empty if none of them contains it.
+func (g *generator) sourceRoot(absPath string) string {
+	for _, importPath := range g.conf.ImportPaths {
+		if rel, err := filepath.Rel(importPath, absPath); err == nil && !strings.HasPrefix(rel, "..") {
+			return importPath
+		}
+	}
+	for _, inputPath := range g.conf.inputPaths() {
+		root := g.conf.inputRoot(inputPath)
+		if rel, err := filepath.Rel(root, absPath); err == nil && !strings.HasPrefix(rel, "..") {
+			return root
+		}
+	}
+	return ""
+}
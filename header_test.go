@@ -0,0 +1,56 @@
+package pbthrift
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStripGeneratedHeader(t *testing.T) {
+	header := func() *Comment {
+		return &Comment{Lines: []string{" generated by protobuf-thrift from a.proto; DO NOT EDIT"}}
+	}
+	note := &Comment{Lines: []string{" hand-written note"}}
+	cases := []struct {
+		name string
+		in   []Element
+		want []Element
+	}{
+		{
+			name: "detached header",
+			in:   []Element{header(), &Package{Trivia: Trivia{Blank: 1}, Name: "foo"}},
+			want: []Element{&Package{Trivia: Trivia{Blank: 1}, Name: "foo"}},
+		},
+		{
+			name: "leading comment of first declaration",
+			in:   []Element{&Package{Trivia: Trivia{Comments: []*Comment{header()}}, Name: "foo"}},
+			want: []Element{&Package{Trivia: Trivia{Comments: []*Comment{}}, Name: "foo"}},
+		},
+		{
+			name: "other comment is kept",
+			in:   []Element{note, &Package{Name: "foo"}},
+			want: []Element{note, &Package{Name: "foo"}},
+		},
+		{
+			name: "header not at the top is kept",
+			in:   []Element{&Package{Name: "foo"}, header()},
+			want: []Element{&Package{Name: "foo"}, header()},
+		},
+		{
+			name: "block comment is kept",
+			in:   []Element{&Comment{Lines: header().Lines, Block: true}},
+			want: []Element{&Comment{Lines: header().Lines, Block: true}},
+		},
+		{
+			name: "empty",
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			s := &Schema{Elements: c.in}
+			stripGeneratedHeader(s)
+			if len(s.Elements) != len(c.want) || (len(c.want) > 0 && !reflect.DeepEqual(s.Elements, c.want)) {
+				t.Errorf("elements = %#v, want %#v", s.Elements, c.want)
+			}
+		})
+	}
+}
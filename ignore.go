@@ -0,0 +1,137 @@
+package pbthrift
+
+import (
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/YYCoder/protobuf-thrift/utils/logger"
+)
+
+// Name of ignore file honoured in every directory of input dir and import paths, it's in the same format as .gitignore
+const IgnoreFileName = ".protobuf-thrift-ignore"
+
+// Pattern of ignore file
+type ignoreRule struct {
+	pattern  string
+	negate   bool // include paths ignored by previous patterns again
+	dirOnly  bool // only match directories
+	anchored bool // match the path relative to directory of ignore file, otherwise match the name only
+}
+
+// Parse content of ignore file, blank lines and lines starting with # are skipped.
+func parseIgnoreRules(content string) (res []ignoreRule) {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimRight(line, " \r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		rule := ignoreRule{}
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimRight(line, "/")
+		}
+		rule.anchored = strings.Contains(line, "/")
+		rule.pattern = strings.TrimLeft(line, "/")
+		if rule.pattern != "" {
+			res = append(res, rule)
+		}
+	}
+	return
+}
+
+// Report whether slash separated path relative to directory of ignore file matches the rule.
+func (r ignoreRule) match(name string, isDir bool) bool {
+	if r.dirOnly && !isDir {
+		return false
+	}
+	if r.anchored {
+		return matchElements(strings.Split(r.pattern, "/"), strings.Split(name, "/"))
+	}
+	ok, _ := path.Match(r.pattern, path.Base(name))
+	return ok
+}
+
+// Report whether the file or dir should not be converted, by include and exclude options, which are matched against
+// the same path as in generated header, and by ignore files in directories from the matched import path or input dir
+// to it. Include option only applies to files. Like git, files in an ignored directory can not be included again.
+func (g *generator) ignored(absPath string, isDir bool) bool {
+	name := g.sourceName(absPath)
+	if !isDir && len(g.conf.Include) > 0 && !matchAnyGlob(g.conf.Include, name) {
+		return true
+	}
+	if matchAnyGlob(g.conf.Exclude, name) {
+		return true
+	}
+
+	root := g.sourceRoot(absPath)
+	if root == "" {
+		return false
+	}
+	rel, err := filepath.Rel(root, absPath)
+	if err != nil || rel == "." {
+		return false
+	}
+	elements := strings.Split(filepath.ToSlash(rel), "/")
+	for i := 1; i <= len(elements); i++ {
+		if g.ignoredByFiles(root, elements[:i], isDir || i < len(elements)) {
+			return true
+		}
+	}
+	return false
+}
+
+// Match the path by ignore files in root and its directories down to the parent of the path, patterns in deeper
+// directories take precedence, and later patterns in the same file take precedence.
+func (g *generator) ignoredByFiles(root string, elements []string, isDir bool) (res bool) {
+	dir := root
+	for i := range elements {
+		name := strings.Join(elements[i:], "/")
+		for _, rule := range g.ignoreRules(dir) {
+			if rule.match(name, isDir) {
+				res = !rule.negate
+			}
+		}
+		dir = filepath.Join(dir, elements[i])
+	}
+	return
+}
+
+// Return patterns of ignore files in the dir, they are loaded only once.
+func (g *generator) ignoreRules(dir string) (res []ignoreRule) {
+	if g.ignoreRuleMap == nil {
+		g.ignoreRuleMap = make(map[string][]ignoreRule)
+	}
+	if res, ok := g.ignoreRuleMap[dir]; ok {
+		return res
+	}
+	for _, name := range append([]string{IgnoreFileName}, g.conf.IgnoreFiles...) {
+		file, err := openFile(g.conf.FS, filepath.Join(dir, name))
+		if err != nil {
+			continue
+		}
+		content, err := io.ReadAll(file)
+		file.Close()
+		if err != nil {
+			logger.Warnf("Could not read ignore file %v, %v", filepath.Join(dir, name), err)
+			continue
+		}
+		res = append(res, parseIgnoreRules(string(content))...)
+	}
+	g.ignoreRuleMap[dir] = res
+	return
+}
+
+func matchAnyGlob(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if matchGlob(pattern, name) {
+			return true
+		}
+	}
+	return false
+}
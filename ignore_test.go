@@ -0,0 +1,128 @@
+package pbthrift
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestParseIgnoreRules(t *testing.T) {
+	content := "# comment\n\n*.bak\n!keep.bak\nbuild/\n/root.proto\napi/*.proto  \r\n!/api/keep/\n/\n"
+	want := []ignoreRule{
+		{pattern: "*.bak"},
+		{pattern: "keep.bak", negate: true},
+		{pattern: "build", dirOnly: true},
+		{pattern: "root.proto", anchored: true},
+		{pattern: "api/*.proto", anchored: true},
+		{pattern: "api/keep", negate: true, dirOnly: true, anchored: true},
+	}
+	if got := parseIgnoreRules(content); !reflect.DeepEqual(got, want) {
+		t.Errorf("parseIgnoreRules() = %+v, want %+v", got, want)
+	}
+}
+
+func TestIgnoreRuleMatch(t *testing.T) {
+	cases := []struct {
+		line  string
+		name  string
+		isDir bool
+		want  bool
+	}{
+		{"*.bak", "a.bak", false, true},
+		{"*.bak", "x/a.bak", false, true},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "x/build", true, true},
+		{"/root.proto", "root.proto", false, true},
+		{"/root.proto", "x/root.proto", false, false},
+		{"api/*.proto", "api/a.proto", false, true},
+		{"api/*.proto", "x/api/a.proto", false, false},
+		{"**/gen", "x/y/gen", true, true},
+		{"**/gen", "gen", true, true},
+	}
+	for _, c := range cases {
+		rules := parseIgnoreRules(c.line)
+		if len(rules) != 1 {
+			t.Fatalf("parseIgnoreRules(%q) = %+v, want one rule", c.line, rules)
+		}
+		if got := rules[0].match(c.name, c.isDir); got != c.want {
+			t.Errorf("rule %q match(%q, dir %v) = %v, want %v", c.line, c.name, c.isDir, got, c.want)
+		}
+	}
+}
+
+func TestIgnored(t *testing.T) {
+	fsys := fstest.MapFS{
+		"idl/" + IgnoreFileName:         {Data: []byte("*.bak.proto\ngen/\n/legacy.proto\nvendor/\n!vendor/\n")},
+		"idl/api/" + IgnoreFileName:     {Data: []byte("!keep.bak.proto\n*.proto\n!user.proto\n")},
+		"idl/api/sub/" + IgnoreFileName: {Data: []byte("!*.proto\n")},
+		"idl/gen/" + IgnoreFileName:     {Data: []byte("!a.proto\n")},
+		"idl/.gitignore":                {Data: []byte("tmp.proto\n")},
+	}
+	cases := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{"/idl/a.proto", false, false},
+		{"/idl/a.bak.proto", false, true},
+		{"/idl/legacy.proto", false, true},
+		{"/idl/x/legacy.proto", false, false},
+		// dir-only rule
+		{"/idl/gen", true, true},
+		{"/idl/x/gen", true, true},
+		{"/idl/gen.proto", false, false},
+		// files in ignored dir can not be included again by deeper ignore files
+		{"/idl/gen/a.proto", false, true},
+		// later rule in the same file takes precedence
+		{"/idl/vendor", true, false},
+		// rules in deeper dir take precedence
+		{"/idl/api/keep.bak.proto", false, true},
+		{"/idl/api/a.proto", false, true},
+		{"/idl/api/user.proto", false, false},
+		{"/idl/api/sub/a.proto", false, false},
+		{"/idl/api/sub/a.bak.proto", false, false},
+		// other ignore files are honoured only when specified
+		{"/idl/tmp.proto", false, false},
+		// outside of input dir
+		{"/other/a.bak.proto", false, false},
+	}
+	for _, c := range cases {
+		g := &generator{conf: &RunnerConfig{FS: fsys, InputPath: "/idl"}}
+		if got := g.ignored(c.path, c.isDir); got != c.want {
+			t.Errorf("ignored(%q, dir %v) = %v, want %v", c.path, c.isDir, got, c.want)
+		}
+	}
+
+	g := &generator{conf: &RunnerConfig{FS: fsys, InputPath: "/idl", IgnoreFiles: []string{".gitignore"}}}
+	if !g.ignored("/idl/tmp.proto", false) {
+		t.Errorf("ignored(%q) = false with ignore file .gitignore, want true", "/idl/tmp.proto")
+	}
+}
+
+func TestIgnoredByOptions(t *testing.T) {
+	cases := []struct {
+		include []string
+		exclude []string
+		path    string
+		isDir   bool
+		want    bool
+	}{
+		{nil, []string{"google/protobuf"}, "/idl/google/protobuf", true, true},
+		{nil, []string{"google/protobuf"}, "/idl/google/protobuf/any.proto", false, true},
+		{nil, []string{"testdata"}, "/idl/api/testdata/a.proto", false, true},
+		{[]string{"api/**/*.proto"}, nil, "/idl/api/x/a.proto", false, false},
+		{[]string{"api/**/*.proto"}, nil, "/idl/b.proto", false, true},
+		// include only applies to files
+		{[]string{"api/**/*.proto"}, nil, "/idl/other", true, false},
+		// exclude takes precedence over include
+		{[]string{"*.proto"}, []string{"api"}, "/idl/api/a.proto", false, true},
+	}
+	for _, c := range cases {
+		g := &generator{conf: &RunnerConfig{FS: fstest.MapFS{}, InputPath: "/idl", Include: c.include, Exclude: c.exclude}}
+		if got := g.ignored(c.path, c.isDir); got != c.want {
+			t.Errorf("ignored(%q, dir %v) with include %q exclude %q = %v, want %v",
+				c.path, c.isDir, c.include, c.exclude, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,124 @@
+package pbthrift
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Return absolute paths of all input files or dirs, InputPath is the first one.
+func (c *RunnerConfig) inputPaths() (res []string) {
+	if c.InputPath != "" {
+		res = append(res, c.InputPath)
+	}
+	return append(res, c.InputPaths...)
+}
+
+// Return the dir which output paths and generated header of files in the input file or dir are relative to, it's the
+// static root of the glob pattern matching the input, i.e. its longest parent dir without glob characters, so that
+// files matched by one pattern keep their layout. Otherwise, it's the input dir itself, or dir of the input file.
+func (c *RunnerConfig) inputRoot(inputPath string) string {
+	if root, ok := c.inputRoots[inputPath]; ok {
+		return root
+	}
+	if stat, err := statFile(c.FS, inputPath); err == nil && !stat.IsDir() {
+		return filepath.Dir(inputPath)
+	}
+	return inputPath
+}
+
+// Convert input paths to absolute paths in fsys, which are relative to its root, or current working directory if fsys
+// is nil. Glob patterns are expanded, and paths found more than once are kept only the first time. Static roots of
+// the patterns are returned by paths matching them.
+func expandInputPaths(fsys fs.FS, inputPaths []string) (res []string, roots map[string]string, err error) {
+	found := map[string]bool{}
+	roots = map[string]string{}
+	for _, p := range inputPaths {
+		if p == "" {
+			continue
+		}
+		if fsys != nil {
+			p = fsAbsPath(p)
+		} else if p, err = absPath(p); err != nil {
+			return
+		}
+		paths := []string{p}
+		root := ""
+		if isGlob(p) {
+			if paths, root, err = expandInputGlob(fsys, p); err != nil {
+				return
+			}
+		}
+		for _, path := range paths {
+			if !found[path] {
+				found[path] = true
+				res = append(res, path)
+				if root != "" {
+					roots[path] = root
+				}
+			}
+		}
+	}
+	return
+}
+
+func isGlob(path string) bool {
+	return strings.ContainsAny(filepath.ToSlash(path), "*?[")
+}
+
+// Return sorted files and dirs matching the absolute glob pattern, ** matches any number of dirs, and the static root
+// of the pattern. Dirs under a matched dir are not matched again, since the dir is converted as a whole.
+func expandInputGlob(fsys fs.FS, pattern string) (res []string, root string, err error) {
+	if err = validateGlob("i", filepath.ToSlash(pattern)); err != nil {
+		return
+	}
+	// walk from the longest parent dir without glob characters
+	elements := strings.Split(filepath.ToSlash(pattern), "/")
+	i := 0
+	for i < len(elements) && !isGlob(elements[i]) {
+		i++
+	}
+	root = filepath.Clean(filepath.FromSlash(strings.Join(elements[:i], "/") + "/"))
+	patterns := elements[i:]
+
+	walkDir(fsys, root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil || rel == "." {
+			return nil
+		}
+		if matchElements(patterns, strings.Split(filepath.ToSlash(rel), "/")) {
+			res = append(res, path)
+			if d.IsDir() {
+				return fs.SkipDir
+			}
+		}
+		return nil
+	})
+	if len(res) == 0 {
+		return nil, "", &OptionError{Option: "i", Value: pattern, Reason: "it matches no file"}
+	}
+	sort.Strings(res)
+	return
+}
+
+// Return file info of the input file or dir, output path of the file is relative to the import path containing it, so
+// that it's consistent with imported files, or its input root otherwise.
+func (g *generator) inputFileInfo(inputPath string) FileInfo {
+	filename, err := filepath.Rel(g.conf.inputRoot(inputPath), inputPath)
+	if err != nil {
+		_, filename = filepath.Split(inputPath)
+	}
+	if isIdl, _ := g.absPathIsIdl(inputPath); isIdl {
+		if relPath, found := relToImportPaths(g.conf.ImportPaths, inputPath); found {
+			filename = relPath
+		}
+	}
+	return FileInfo{
+		absPath:    inputPath,
+		outputPath: filepath.Join(g.conf.OutputDir, g.replaceExt(filename)),
+	}
+}
@@ -0,0 +1,235 @@
+package pbthrift
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"reflect"
+	"sync"
+	"syscall"
+	"testing"
+	"testing/fstest"
+)
+
+func TestExpandInputPaths(t *testing.T) {
+	fsys := fstest.MapFS{
+		"idl/a.proto":        {},
+		"idl/v1/a.proto":     {},
+		"idl/v1/sub/b.proto": {},
+		"idl/v2/a.proto":     {},
+		"other/c.proto":      {},
+	}
+	cases := []struct {
+		name  string
+		paths []string
+		want  []string
+		roots map[string]string
+	}{
+		{
+			name:  "plain paths",
+			paths: []string{"idl/a.proto", "other"},
+			want:  []string{"/idl/a.proto", "/other"},
+			roots: map[string]string{},
+		},
+		{
+			name:  "glob keeps its static root",
+			paths: []string{"idl/v*/a.proto"},
+			want:  []string{"/idl/v1/a.proto", "/idl/v2/a.proto"},
+			roots: map[string]string{"/idl/v1/a.proto": "/idl", "/idl/v2/a.proto": "/idl"},
+		},
+		{
+			name:  "double star",
+			paths: []string{"idl/**/*.proto"},
+			want:  []string{"/idl/a.proto", "/idl/v1/a.proto", "/idl/v1/sub/b.proto", "/idl/v2/a.proto"},
+			roots: map[string]string{
+				"/idl/a.proto":        "/idl",
+				"/idl/v1/a.proto":     "/idl",
+				"/idl/v1/sub/b.proto": "/idl",
+				"/idl/v2/a.proto":     "/idl",
+			},
+		},
+		{
+			name:  "matched dir is not walked again",
+			paths: []string{"idl/v*", "idl/**/b.proto"},
+			want:  []string{"/idl/v1", "/idl/v2", "/idl/v1/sub/b.proto"},
+			roots: map[string]string{"/idl/v1": "/idl", "/idl/v2": "/idl", "/idl/v1/sub/b.proto": "/idl"},
+		},
+		{
+			name:  "path found twice is kept the first time",
+			paths: []string{"idl/v1/a.proto", "idl/*/a.proto"},
+			want:  []string{"/idl/v1/a.proto", "/idl/v2/a.proto"},
+			roots: map[string]string{"/idl/v2/a.proto": "/idl"},
+		},
+		{
+			name:  "glob from root",
+			paths: []string{"*/c.proto"},
+			want:  []string{"/other/c.proto"},
+			roots: map[string]string{"/other/c.proto": "/"},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			got, roots, err := expandInputPaths(fsys, c.paths)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("paths = %q, want %q", got, c.want)
+			}
+			if !reflect.DeepEqual(roots, c.roots) {
+				t.Errorf("roots = %q, want %q", roots, c.roots)
+			}
+		})
+	}
+
+	if _, _, err := expandInputPaths(fsys, []string{"idl/*.thrift"}); !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expandInputPaths matching no file = %v, want ErrInvalidOption", err)
+	}
+}
+
+func TestInputFileInfo(t *testing.T) {
+	fsys := fstest.MapFS{
+		"idl/v1/a.proto":     {},
+		"idl/v1/sub/b.proto": {},
+		"idl/v2/a.proto":     {},
+		"other/c.proto":      {},
+	}
+	cases := []struct {
+		name    string
+		inputs  []string
+		imports []string
+		want    map[string]string // absolute path => output path
+	}{
+		{
+			name:   "file",
+			inputs: []string{"idl/v1/a.proto"},
+			want:   map[string]string{"/idl/v1/a.proto": "/out/a.thrift"},
+		},
+		{
+			name:   "files matched by glob",
+			inputs: []string{"idl/*/a.proto", "other/c.proto"},
+			want: map[string]string{
+				"/idl/v1/a.proto": "/out/v1/a.thrift",
+				"/idl/v2/a.proto": "/out/v2/a.thrift",
+				"/other/c.proto":  "/out/c.thrift",
+			},
+		},
+		{
+			name:    "import path takes precedence",
+			inputs:  []string{"idl/*/a.proto"},
+			imports: []string{"/idl/v1"},
+			want: map[string]string{
+				"/idl/v1/a.proto": "/out/a.thrift",
+				"/idl/v2/a.proto": "/out/v2/a.thrift",
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			conf := &RunnerConfig{FS: fsys, OutputDir: "/out", Task: TASK_FILE_PROTO2THRIFT, ImportPaths: c.imports}
+			paths, roots, err := expandInputPaths(fsys, c.inputs)
+			if err != nil {
+				t.Fatal(err)
+			}
+			conf.InputPath, conf.InputPaths, conf.inputRoots = paths[0], paths[1:], roots
+			g := &generator{conf: conf}
+			got := map[string]string{}
+			for _, p := range conf.inputPaths() {
+				got[p] = g.inputFileInfo(p).outputPath
+			}
+			if !reflect.DeepEqual(got, c.want) {
+				t.Errorf("output paths = %q, want %q", got, c.want)
+			}
+		})
+	}
+}
+
+func TestGlobInputDir(t *testing.T) {
+	fsys := fstest.MapFS{
+		"idl/v1/a.proto":     {},
+		"idl/v1/sub/b.proto": {},
+		"idl/v2/a.proto":     {},
+	}
+	paths, roots, err := expandInputPaths(fsys, []string{"idl/v*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conf := &RunnerConfig{FS: fsys, OutputDir: "/out", Task: TASK_FILE_PROTO2THRIFT}
+	conf.InputPath, conf.InputPaths, conf.inputRoots = paths[0], paths[1:], roots
+	g := &generator{conf: conf}
+	got := map[string]string{}
+	for _, p := range conf.inputPaths() {
+		files, err := g.getAllFileFromDir(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, f := range files {
+			got[f.absPath] = f.outputPath
+		}
+	}
+	want := map[string]string{
+		"/idl/v1/a.proto":     "/out/v1/a.thrift",
+		"/idl/v1/sub/b.proto": "/out/v1/sub/b.thrift",
+		"/idl/v2/a.proto":     "/out/v2/a.thrift",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("output paths = %q, want %q", got, want)
+	}
+	if name := g.sourceName("/idl/v1/sub/b.proto"); name != "v1/sub/b.proto" {
+		t.Errorf("sourceName = %q, want %q", name, "v1/sub/b.proto")
+	}
+}
+
+// File system failing to open files like a process running out of file descriptors, when limit files are open.
+type limitedFS struct {
+	fstest.MapFS
+	limit int
+
+	mu   sync.Mutex
+	open int
+}
+
+func (f *limitedFS) Open(name string) (fs.File, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.open >= f.limit {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: syscall.EMFILE}
+	}
+	file, err := f.MapFS.Open(name)
+	if err == nil {
+		f.open++
+		file = &limitedFile{File: file, fs: f}
+	}
+	return file, err
+}
+
+type limitedFile struct {
+	fs.File
+	fs *limitedFS
+}
+
+func (f *limitedFile) Close() error {
+	f.fs.mu.Lock()
+	f.fs.open--
+	f.fs.mu.Unlock()
+	return f.File.Close()
+}
+
+func TestGlobInputOverFileLimit(t *testing.T) {
+	fsys := &limitedFS{MapFS: fstest.MapFS{}, limit: 16}
+	for i := 0; i < 100; i++ {
+		fsys.MapFS[fmt.Sprintf("idl/v%d/a.proto", i)] = &fstest.MapFile{Data: []byte("syntax = \"proto3\";\nmessage A {\n}\n")}
+	}
+	files := pipeFiles(t, RunnerConfig{
+		FS:        fsys,
+		Task:      TASK_FILE_PROTO2THRIFT,
+		InputPath: "idl/**/a.proto",
+		OutputDir: "/out",
+	})
+	if len(files) != 100 {
+		t.Errorf("converted files = %d, want 100", len(files))
+	}
+	if fsys.open != 0 {
+		t.Errorf("%d files are left open", fsys.open)
+	}
+}
@@ -0,0 +1,367 @@
+package pbthrift
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/emicklei/proto"
+)
+
+// Lower protobuf ast into schema. Detached comments inside declarations are attached to the next element, oneof
+// fields, options, reserved and extensions are ignored.
+func LowerProto(def *proto.Proto) (res *Schema) {
+	res = &Schema{}
+	for _, e := range def.Elements {
+		switch e := e.(type) {
+		case *proto.Syntax:
+			switch e.Value {
+			case "proto2":
+				res.Syntax = 2
+			case "proto3":
+				res.Syntax = 3
+			}
+		case *proto.Package:
+			res.Elements = append(res.Elements, &Package{
+				Trivia: lowerProtoTrivia(nil, e.Comment, e.InlineComment),
+				Name:   e.Name,
+			})
+		case *proto.Import:
+			res.Elements = append(res.Elements, &Import{
+				Trivia: lowerProtoTrivia(nil, e.Comment, e.InlineComment),
+				Path:   e.Filename,
+				Kind:   e.Kind,
+			})
+		case *proto.Message:
+			res.Elements = append(res.Elements, lowerProtoMessage(nil, e))
+		case *proto.Enum:
+			res.Elements = append(res.Elements, lowerProtoEnum(nil, e))
+		case *proto.Service:
+			res.Elements = append(res.Elements, lowerProtoService(e))
+		case *proto.Comment:
+			res.Elements = append(res.Elements, lowerProtoComment(e))
+		}
+	}
+	return
+}
+
+func lowerProtoMessage(detached []*Comment, m *proto.Message) (res *Message) {
+	res = &Message{
+		Trivia: lowerProtoTrivia(detached, m.Comment, nil),
+		Name:   m.Name,
+	}
+	var comments []*Comment
+	for _, e := range m.Elements {
+		switch e := e.(type) {
+		case *proto.NormalField:
+			t := lowerProtoType(e.Type)
+			if e.Repeated {
+				t = &Type{Kind: TypeList, Elem: t}
+			}
+			res.Fields = append(res.Fields, &Field{
+				Trivia:   lowerProtoTrivia(comments, e.Comment, e.InlineComment),
+				Name:     e.Name,
+				ID:       e.Sequence,
+				Type:     t,
+				Optional: e.Optional,
+			})
+		case *proto.MapField:
+			res.Fields = append(res.Fields, &Field{
+				Trivia: lowerProtoTrivia(comments, e.Comment, e.InlineComment),
+				Name:   e.Name,
+				ID:     e.Sequence,
+				Type:   &Type{Kind: TypeMap, Key: lowerProtoType(e.KeyType), Elem: lowerProtoType(e.Type)},
+			})
+		case *proto.Message:
+			res.Nested = append(res.Nested, lowerProtoMessage(comments, e))
+		case *proto.Enum:
+			res.Nested = append(res.Nested, lowerProtoEnum(comments, e))
+		case *proto.Comment:
+			comments = append(comments, lowerProtoComment(e))
+			continue
+		default:
+			continue
+		}
+		comments = nil
+	}
+	res.EndComments = comments
+	return
+}
+
+func lowerProtoEnum(detached []*Comment, e *proto.Enum) (res *Enum) {
+	res = &Enum{
+		Trivia: lowerProtoTrivia(detached, e.Comment, nil),
+		Name:   e.Name,
+	}
+	var comments []*Comment
+	for _, ele := range e.Elements {
+		switch ele := ele.(type) {
+		case *proto.EnumField:
+			res.Values = append(res.Values, &EnumValue{
+				Trivia: lowerProtoTrivia(comments, ele.Comment, ele.InlineComment),
+				Name:   ele.Name,
+				Value:  ele.Integer,
+			})
+			comments = nil
+		case *proto.Comment:
+			comments = append(comments, lowerProtoComment(ele))
+		}
+	}
+	res.EndComments = comments
+	return
+}
+
+func lowerProtoService(s *proto.Service) (res *Service) {
+	res = &Service{
+		Trivia: lowerProtoTrivia(nil, s.Comment, nil),
+		Name:   s.Name,
+	}
+	var comments []*Comment
+	for _, e := range s.Elements {
+		switch e := e.(type) {
+		case *proto.RPC:
+			res.Methods = append(res.Methods, &Method{
+				Trivia:   lowerProtoTrivia(comments, e.Comment, e.InlineComment),
+				Name:     e.Name,
+				Request:  lowerProtoType(e.RequestType),
+				Response: lowerProtoType(e.ReturnsType),
+			})
+			comments = nil
+		case *proto.Comment:
+			comments = append(comments, lowerProtoComment(e))
+		}
+	}
+	res.EndComments = comments
+	return
+}
+
+// Return trivia of a declaration, detached comments above it are kept before its own comment.
+func lowerProtoTrivia(detached []*Comment, comment *proto.Comment, inlineComment *proto.Comment) (res Trivia) {
+	res.Comments = append(res.Comments, detached...)
+	if comment != nil {
+		res.Comments = append(res.Comments, lowerProtoComment(comment))
+	}
+	if inlineComment != nil {
+		res.InlineComment = lowerProtoComment(inlineComment)
+	}
+	return
+}
+
+func lowerProtoComment(c *proto.Comment) (res *Comment) {
+	res = &Comment{Block: c.Cstyle}
+	for _, line := range c.Lines {
+		// the third slash is not a part of comment text in proto ast
+		if c.ExtraSlash {
+			line = "/" + line
+		}
+		res.Lines = append(res.Lines, line)
+	}
+	return
+}
+
+func lowerProtoType(t string) (res *Type) {
+	if baseTypes[t] {
+		return &Type{Kind: TypeBase, Name: t}
+	}
+	return &Type{Kind: TypeNamed, Name: t}
+}
+
+// Return protobuf scalar type for base type, thrift byte and i16 are widened to int32.
+func protoBaseType(t string) (res string, ok bool) {
+	switch t {
+	case "int8", "int16":
+		return "int32", true
+	}
+	return t, baseTypes[t]
+}
+
+// Print schema as protobuf idl, indent is the string for each indent level. Since protobuf has no annotations, options
+// of declarations are not printed.
+func PrintProto(s *Schema, indent string) (res []byte) {
+	p := &protoPrinter{syntax: s.Syntax, indent: indent}
+	if s.Syntax != 0 {
+		p.buf.WriteString(fmt.Sprintf("syntax = \"proto%d\";\n", s.Syntax))
+	}
+	for _, e := range s.Elements {
+		p.element(e, 0)
+	}
+	return p.buf.Bytes()
+}
+
+type protoPrinter struct {
+	buf    bytes.Buffer
+	syntax int
+	indent string
+}
+
+func (p *protoPrinter) element(e Element, depth int) {
+	switch e := e.(type) {
+	case *Comment:
+		p.comment(e, depth)
+	case *Package:
+		p.declaration(e.Trivia, depth, fmt.Sprintf("package %s;", e.Name))
+	case *Import:
+		if e.Kind != "" {
+			p.declaration(e.Trivia, depth, fmt.Sprintf("import %s \"%s\";", e.Kind, e.Path))
+		} else {
+			p.declaration(e.Trivia, depth, fmt.Sprintf("import \"%s\";", e.Path))
+		}
+	case *Message:
+		p.message(e, depth)
+	case *Enum:
+		p.enum(e, depth)
+	case *Service:
+		p.service(e, depth)
+	}
+}
+
+func (p *protoPrinter) message(m *Message, depth int) {
+	p.leading(m.Trivia, depth)
+	p.writeIndent(depth)
+	p.buf.WriteString(fmt.Sprintf("message %s {", m.Name))
+	if len(m.Fields) == 0 && len(m.Nested) == 0 && len(m.EndComments) == 0 {
+		p.closing(m.Trivia, -1)
+		return
+	}
+	p.buf.WriteString("\n")
+	for _, f := range m.Fields {
+		p.declaration(f.Trivia, depth+1, p.field(f))
+	}
+	for _, e := range m.Nested {
+		p.element(e, depth+1)
+	}
+	for _, c := range m.EndComments {
+		p.comment(c, depth+1)
+	}
+	p.closing(m.Trivia, depth)
+}
+
+func (p *protoPrinter) field(f *Field) string {
+	label := ""
+	switch {
+	case f.Type.Kind == TypeList || f.Type.Kind == TypeSet:
+		label = "repeated "
+	case f.Optional && p.syntax == 2:
+		// proto3 fields have no requiredness
+		label = "optional "
+	}
+	return fmt.Sprintf("%s%s %s = %d;", label, p.typeName(f.Type), f.Name, f.ID)
+}
+
+// Return type name, since protobuf has no nested list, set or map, nested ones are replaced by their element type.
+func (p *protoPrinter) typeName(t *Type) string {
+	switch t.Kind {
+	case TypeBase:
+		name, _ := protoBaseType(t.Name)
+		return name
+	case TypeList, TypeSet:
+		return p.typeName(t.Elem)
+	case TypeMap:
+		return fmt.Sprintf("map<%s, %s>", p.typeName(t.Key), p.typeName(t.Elem))
+	}
+	return t.Name
+}
+
+func (p *protoPrinter) enum(e *Enum, depth int) {
+	p.leading(e.Trivia, depth)
+	p.writeIndent(depth)
+	p.buf.WriteString(fmt.Sprintf("enum %s {", e.Name))
+	if len(e.Values) == 0 && len(e.EndComments) == 0 {
+		p.closing(e.Trivia, -1)
+		return
+	}
+	p.buf.WriteString("\n")
+	for _, v := range e.Values {
+		p.declaration(v.Trivia, depth+1, fmt.Sprintf("%s = %d;", v.Name, v.Value))
+	}
+	for _, c := range e.EndComments {
+		p.comment(c, depth+1)
+	}
+	p.closing(e.Trivia, depth)
+}
+
+func (p *protoPrinter) service(s *Service, depth int) {
+	p.leading(s.Trivia, depth)
+	p.writeIndent(depth)
+	p.buf.WriteString(fmt.Sprintf("service %s {", s.Name))
+	if len(s.Methods) == 0 && len(s.EndComments) == 0 {
+		p.closing(s.Trivia, -1)
+		return
+	}
+	p.buf.WriteString("\n")
+	for _, m := range s.Methods {
+		var req, res string
+		if m.Request != nil {
+			req = p.typeName(m.Request)
+		}
+		if m.Response != nil {
+			res = p.typeName(m.Response)
+		}
+		p.declaration(m.Trivia, depth+1, fmt.Sprintf("rpc %s(%s) returns (%s) {}", m.Name, req, res))
+	}
+	for _, c := range s.EndComments {
+		p.comment(c, depth+1)
+	}
+	p.closing(s.Trivia, depth)
+}
+
+// Write a single line declaration with its comments.
+func (p *protoPrinter) declaration(t Trivia, depth int, line string) {
+	p.leading(t, depth)
+	p.writeIndent(depth)
+	p.buf.WriteString(line)
+	p.inlineComment(t.InlineComment)
+	p.buf.WriteString("\n")
+}
+
+func (p *protoPrinter) leading(t Trivia, depth int) {
+	for _, c := range t.Comments {
+		p.comment(c, depth)
+	}
+	p.blank(t.Blank)
+}
+
+// Write closing brace of a declaration, depth is -1 if the brace follows the opening one.
+func (p *protoPrinter) closing(t Trivia, depth int) {
+	p.writeIndent(depth)
+	p.buf.WriteString("}")
+	p.inlineComment(t.InlineComment)
+	p.buf.WriteString("\n")
+}
+
+func (p *protoPrinter) comment(c *Comment, depth int) {
+	p.blank(c.Blank)
+	if c.Block {
+		p.writeIndent(depth)
+		p.buf.WriteString(fmt.Sprintf("/*%s*/\n", strings.Join(c.Lines, "\n")))
+		return
+	}
+	for _, line := range c.Lines {
+		p.writeIndent(depth)
+		p.buf.WriteString(fmt.Sprintf("//%s\n", line))
+	}
+}
+
+func (p *protoPrinter) inlineComment(c *Comment) {
+	if c == nil {
+		return
+	}
+	p.buf.WriteString(p.indent)
+	if c.Block {
+		p.buf.WriteString(fmt.Sprintf("/*%s*/", strings.Join(c.Lines, "\n")))
+	} else if len(c.Lines) > 0 {
+		p.buf.WriteString(fmt.Sprintf("//%s", c.Lines[0]))
+	}
+}
+
+func (p *protoPrinter) blank(count int) {
+	for i := 0; i < count; i++ {
+		p.buf.WriteString("\n")
+	}
+}
+
+func (p *protoPrinter) writeIndent(depth int) {
+	for i := 0; i < depth; i++ {
+		p.buf.WriteString(p.indent)
+	}
+}
@@ -0,0 +1,70 @@
+package pbthrift
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/emicklei/proto"
+)
+
+func lowerPrintProto(t *testing.T, content string) string {
+	t.Helper()
+	def, err := proto.NewParser(strings.NewReader(content)).Parse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(PrintProto(LowerProto(def), "\t"))
+}
+
+// Blank lines are not lowered from protobuf, generators add them when converting.
+func TestProtoRoundTrip(t *testing.T) {
+	content := `syntax = "proto3";
+// package comment
+package api.user;	// inline
+import "common/base.proto";
+import public "common/types.proto";
+// detached comment
+// user
+message User {
+	// name
+	string name = 1;
+	repeated int64 ids = 2;	// ids
+	map<string, common.Base> bases = 3;
+	Inner inner = 4;
+	message Inner {
+		bytes data = 1;
+	}
+}
+enum Kind {
+	UNKNOWN = 0;
+	ADMIN = 1;	// admin
+}
+service UserService {
+	// get user
+	rpc GetUser(User) returns (User) {}
+}
+`
+	if got := lowerPrintProto(t, content); got != content {
+		t.Errorf("round trip =\n%s\nwant\n%s", got, content)
+	}
+}
+
+func TestProtoRoundTripExamples(t *testing.T) {
+	paths, err := filepath.Glob("example/*proto2thrift/*.proto")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// printed output is stable once lowered and printed
+		printed := lowerPrintProto(t, string(content))
+		if got := lowerPrintProto(t, printed); got != printed {
+			t.Errorf("%s round trip =\n%s\nwant\n%s", path, got, printed)
+		}
+	}
+}
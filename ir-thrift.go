@@ -0,0 +1,523 @@
+package pbthrift
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/YYCoder/thrifter"
+)
+
+// Lower thrift ast into schema. Only the first namespace is kept as package, since protobuf file has exactly one
+// package. Typedef, const, union, exception and senum are ignored, comments above them are kept as detached comments.
+func LowerThrift(def *thrifter.Thrift) (res *Schema) {
+	res = &Schema{}
+	nodes := map[*thrifter.Token]thrifter.Node{}
+	for _, node := range def.Nodes {
+		switch n := node.(type) {
+		case *thrifter.Namespace:
+			nodes[n.StartToken] = n
+		case *thrifter.Include:
+			nodes[n.StartToken] = n
+		case *thrifter.Struct:
+			if n.Type == thrifter.STRUCT {
+				nodes[n.StartToken] = n
+			}
+		case *thrifter.Enum:
+			nodes[n.StartToken] = n
+		case *thrifter.Service:
+			nodes[n.StartToken] = n
+		}
+	}
+
+	l := &thriftLowering{}
+	hasPackage := false
+	for tok := def.StartToken; tok != nil; {
+		var e Element
+		var t *Trivia
+		var end *thrifter.Token
+		switch n := nodes[tok].(type) {
+		case *thrifter.Namespace:
+			if hasPackage {
+				break
+			}
+			hasPackage = true
+			p := &Package{Trivia: l.trivia(), Name: n.Value}
+			e, t, end = p, &p.Trivia, n.EndToken
+		case *thrifter.Include:
+			i := &Import{Trivia: l.trivia(), Path: n.FilePath}
+			e, t, end = i, &i.Trivia, n.EndToken
+		case *thrifter.Struct:
+			m := l.message(n)
+			e, t, end = m, &m.Trivia, n.EndToken
+		case *thrifter.Enum:
+			enum := l.enum(n)
+			e, t, end = enum, &enum.Trivia, n.EndToken
+		case *thrifter.Service:
+			s := l.service(n)
+			e, t, end = s, &s.Trivia, n.EndToken
+		}
+
+		if e == nil {
+			if !isThriftLayoutToken(tok) {
+				res.Elements = append(res.Elements, l.detach()...)
+			}
+			l.token(tok)
+			tok = tok.Next
+			continue
+		}
+		// same as protobuf, comments separated from the declaration by blank lines are detached
+		if t.Blank > 0 {
+			for _, c := range t.Comments {
+				res.Elements = append(res.Elements, c)
+			}
+			t.Comments = nil
+			setBlankAbove(e, t.Blank)
+		}
+		res.Elements = append(res.Elements, e)
+		tok = l.inline(t, end)
+	}
+	res.Elements = append(res.Elements, l.detach()...)
+	return
+}
+
+// State of lowering thrift tokens which are not part of any node, e.g. comments and line breaks
+type thriftLowering struct {
+	breaks   int        // line breaks since the last token other than white space
+	started  bool       // whether any token other than white space has been lowered
+	comments []*Comment // comments waiting to be attached to the next declaration
+}
+
+// Lower a token which is not part of any declaration.
+func (l *thriftLowering) token(tok *thrifter.Token) {
+	switch tok.Type {
+	case thrifter.T_LINEBREAK:
+		l.breaks++
+	case thrifter.T_SPACE, thrifter.T_TAB, thrifter.T_RETURN:
+	case thrifter.T_COMMENT:
+		c := lowerThriftComment(tok)
+		c.Blank = l.blank()
+		l.comments = append(l.comments, c)
+	default:
+		l.blank()
+	}
+}
+
+// Return the count of blank lines since the last token other than white space.
+func (l *thriftLowering) blank() (res int) {
+	res = l.breaks
+	if l.started && res > 0 {
+		res--
+	}
+	l.started = true
+	l.breaks = 0
+	return
+}
+
+// Return trivia for the declaration starting at current token, waiting comments are attached to it.
+func (l *thriftLowering) trivia() (res Trivia) {
+	res.Blank = l.blank()
+	res.Comments, l.comments = l.comments, nil
+	return
+}
+
+// Return waiting comments as detached comments.
+func (l *thriftLowering) detach() (res []Element) {
+	for _, c := range l.comments {
+		res = append(res, c)
+	}
+	l.comments = nil
+	return
+}
+
+// Lower the comment following the declaration ending with end token on the same line as its inline comment, return the
+// next token to lower.
+func (l *thriftLowering) inline(t *Trivia, end *thrifter.Token) (next *thrifter.Token) {
+	l.blank()
+	next = end.Next
+	for next != nil {
+		switch next.Type {
+		case thrifter.T_SPACE, thrifter.T_TAB, thrifter.T_COMMA, thrifter.T_SEMICOLON:
+			next = next.Next
+			continue
+		case thrifter.T_COMMENT:
+			t.InlineComment = lowerThriftComment(next)
+			return next.Next
+		}
+		return
+	}
+	return
+}
+
+// Skip tokens until the opening brace of a declaration body, return the token after it.
+func (l *thriftLowering) body(start *thrifter.Token) (tok *thrifter.Token) {
+	for tok = start; tok != nil && tok.Type != thrifter.T_LEFTCURLY; tok = tok.Next {
+	}
+	if tok != nil {
+		tok = tok.Next
+	}
+	return
+}
+
+// Return whether the token is the closing brace of declaration body or end of the declaration.
+func isBodyEnd(tok *thrifter.Token, end *thrifter.Token) bool {
+	return tok == nil || tok == end || tok.Type == thrifter.T_RIGHTCURLY
+}
+
+func (l *thriftLowering) message(s *thrifter.Struct) (res *Message) {
+	res = &Message{Trivia: l.trivia(), Name: s.Ident, Options: lowerThriftOptions(s.Options)}
+	fields := map[*thrifter.Token]*thrifter.Field{}
+	for _, f := range s.Elems {
+		fields[f.StartToken] = f
+	}
+	for tok := l.body(s.StartToken); !isBodyEnd(tok, s.EndToken); {
+		f, ok := fields[tok]
+		if !ok {
+			l.token(tok)
+			tok = tok.Next
+			continue
+		}
+		field := &Field{
+			Trivia:   l.trivia(),
+			Name:     f.Ident,
+			ID:       f.ID,
+			Type:     lowerThriftType(f.FieldType),
+			Optional: f.Requiredness == "optional",
+		}
+		res.Fields = append(res.Fields, field)
+		tok = l.inline(&field.Trivia, f.EndToken)
+	}
+	res.EndComments, l.comments = l.comments, nil
+	l.blank()
+	return
+}
+
+func (l *thriftLowering) enum(e *thrifter.Enum) (res *Enum) {
+	res = &Enum{Trivia: l.trivia(), Name: e.Ident, Options: lowerThriftOptions(e.Options)}
+	values := map[*thrifter.Token]*thrifter.EnumElement{}
+	for _, v := range e.Elems {
+		values[v.StartToken] = v
+	}
+	for tok := l.body(e.StartToken); !isBodyEnd(tok, e.EndToken); {
+		v, ok := values[tok]
+		if !ok {
+			l.token(tok)
+			tok = tok.Next
+			continue
+		}
+		value := &EnumValue{Trivia: l.trivia(), Name: v.Ident, Value: v.ID}
+		res.Values = append(res.Values, value)
+		tok = l.inline(&value.Trivia, v.EndToken)
+	}
+	res.EndComments, l.comments = l.comments, nil
+	l.blank()
+	return
+}
+
+func (l *thriftLowering) service(s *thrifter.Service) (res *Service) {
+	res = &Service{Trivia: l.trivia(), Name: s.Ident}
+	functions := map[*thrifter.Token]*thrifter.Function{}
+	for _, f := range s.Elems {
+		functions[f.StartToken] = f
+	}
+	for tok := l.body(s.StartToken); !isBodyEnd(tok, s.EndToken); {
+		f, ok := functions[tok]
+		if !ok {
+			l.token(tok)
+			tok = tok.Next
+			continue
+		}
+		method := &Method{Trivia: l.trivia(), Name: f.Ident}
+		// oneway, throws and options are ignored
+		if len(f.Args) > 0 {
+			method.Argument = f.Args[0].Ident
+			method.Request = lowerThriftType(f.Args[0].FieldType)
+		}
+		if !f.Void && f.FunctionType != nil {
+			method.Response = lowerThriftType(f.FunctionType)
+		}
+		res.Methods = append(res.Methods, method)
+		tok = l.inline(&method.Trivia, f.EndToken)
+	}
+	res.EndComments, l.comments = l.comments, nil
+	l.blank()
+	return
+}
+
+func isThriftLayoutToken(tok *thrifter.Token) bool {
+	switch tok.Type {
+	case thrifter.T_LINEBREAK, thrifter.T_SPACE, thrifter.T_TAB, thrifter.T_RETURN, thrifter.T_COMMENT:
+		return true
+	}
+	return false
+}
+
+func lowerThriftComment(tok *thrifter.Token) (res *Comment) {
+	raw := tok.Raw
+	switch {
+	case strings.HasPrefix(raw, "#"):
+		return &Comment{Lines: []string{raw[1:]}}
+	case strings.HasPrefix(raw, "/*"):
+		raw = strings.TrimSuffix(strings.TrimPrefix(raw, "/*"), "*/")
+		return &Comment{Lines: strings.Split(raw, "\n"), Block: true}
+	}
+	return &Comment{Lines: []string{strings.TrimPrefix(raw, "//")}}
+}
+
+func lowerThriftOptions(options []*thrifter.Option) (res []*Option) {
+	for _, opt := range options {
+		res = append(res, &Option{Name: opt.Name, Value: opt.Value})
+	}
+	return
+}
+
+// Base types of thrift => base types of schema
+var thriftBaseTypes = map[string]string{
+	"bool":   "bool",
+	"byte":   "int8",
+	"i8":     "int8",
+	"i16":    "int16",
+	"i32":    "int32",
+	"i64":    "int64",
+	"double": "double",
+	"string": "string",
+	"binary": "bytes",
+}
+
+func lowerThriftType(t *thrifter.FieldType) (res *Type) {
+	if t == nil {
+		return
+	}
+	switch t.Type {
+	case thrifter.FIELD_TYPE_BASE:
+		if name, ok := thriftBaseTypes[t.BaseType]; ok {
+			return &Type{Kind: TypeBase, Name: name}
+		}
+		return &Type{Kind: TypeNamed, Name: t.BaseType}
+	case thrifter.FIELD_TYPE_LIST:
+		return &Type{Kind: TypeList, Elem: lowerThriftType(t.List.Elem)}
+	case thrifter.FIELD_TYPE_SET:
+		return &Type{Kind: TypeSet, Elem: lowerThriftType(t.Set.Elem)}
+	case thrifter.FIELD_TYPE_MAP:
+		return &Type{Kind: TypeMap, Key: lowerThriftType(t.Map.Key), Elem: lowerThriftType(t.Map.Value)}
+	}
+	return &Type{Kind: TypeNamed, Name: t.Ident}
+}
+
+// Return thrift base type for base type, protobuf float is widened to double.
+func thriftBaseType(t string) (res string, ok bool) {
+	switch t {
+	case "bool", "double", "string":
+		return t, true
+	case "int8":
+		return "byte", true
+	case "int16":
+		return "i16", true
+	case "int32":
+		return "i32", true
+	case "int64":
+		return "i64", true
+	case "float":
+		return "double", true
+	case "bytes":
+		return "binary", true
+	}
+	return t, false
+}
+
+// Print schema as thrift idl, indent is the string for each indent level. Since thrift has no nested declarations,
+// nested ones are printed after their enclosing message.
+func PrintThrift(s *Schema, indent string) (res []byte) {
+	p := &thriftPrinter{indent: indent}
+	for _, e := range s.Elements {
+		p.element(e)
+	}
+	return p.buf.Bytes()
+}
+
+type thriftPrinter struct {
+	buf    bytes.Buffer
+	indent string
+}
+
+func (p *thriftPrinter) element(e Element) {
+	switch e := e.(type) {
+	case *Comment:
+		p.comment(e, 0)
+	case *Package:
+		// thrift namespace and include have no semicolon at the end
+		p.leading(e.Trivia, 0)
+		p.buf.WriteString(fmt.Sprintf("namespace * %s", e.Name))
+		p.inlineComment(e.InlineComment)
+		p.buf.WriteString("\n\n")
+	case *Import:
+		p.leading(e.Trivia, 0)
+		p.buf.WriteString(fmt.Sprintf("include \"%s\"", e.Path))
+		p.inlineComment(e.InlineComment)
+		p.buf.WriteString("\n")
+	case *Message:
+		p.message(e)
+	case *Enum:
+		p.enum(e)
+	case *Service:
+		p.service(e)
+	}
+}
+
+func (p *thriftPrinter) message(m *Message) {
+	p.leading(m.Trivia, 0)
+	p.buf.WriteString(fmt.Sprintf("struct %s {\n", m.Name))
+	for _, f := range m.Fields {
+		p.leading(f.Trivia, 1)
+		p.writeIndent(1)
+		requiredness := ""
+		if f.Optional {
+			requiredness = " optional"
+		}
+		p.buf.WriteString(fmt.Sprintf("%d:%s %s %s", f.ID, requiredness, p.typeName(f.Type), f.Name))
+		p.inlineComment(f.InlineComment)
+		p.buf.WriteString("\n")
+	}
+	p.closing(m.Trivia, m.EndComments, m.Options)
+	for _, e := range m.Nested {
+		p.element(e)
+	}
+}
+
+func (p *thriftPrinter) typeName(t *Type) string {
+	switch t.Kind {
+	case TypeBase:
+		name, _ := thriftBaseType(t.Name)
+		return name
+	case TypeList:
+		return fmt.Sprintf("list<%s>", p.typeName(t.Elem))
+	case TypeSet:
+		return fmt.Sprintf("set<%s>", p.typeName(t.Elem))
+	case TypeMap:
+		return fmt.Sprintf("map<%s, %s>", p.typeName(t.Key), p.typeName(t.Elem))
+	}
+	return t.Name
+}
+
+func (p *thriftPrinter) enum(e *Enum) {
+	p.leading(e.Trivia, 0)
+	p.buf.WriteString(fmt.Sprintf("enum %s {\n", e.Name))
+	for _, v := range e.Values {
+		p.leading(v.Trivia, 1)
+		p.writeIndent(1)
+		p.buf.WriteString(fmt.Sprintf("%s = %d", v.Name, v.Value))
+		p.inlineComment(v.InlineComment)
+		p.buf.WriteString("\n")
+	}
+	p.closing(e.Trivia, e.EndComments, e.Options)
+}
+
+func (p *thriftPrinter) service(s *Service) {
+	p.leading(s.Trivia, 0)
+	p.buf.WriteString(fmt.Sprintf("\nservice %s {\n", s.Name))
+	for _, m := range s.Methods {
+		p.leading(m.Trivia, 1)
+		p.writeIndent(1)
+		res := "void"
+		if m.Response != nil {
+			res = p.typeName(m.Response)
+		}
+		if m.Request != nil {
+			argument := m.Argument
+			if argument == "" {
+				argument = "req"
+			}
+			p.buf.WriteString(fmt.Sprintf("%s %s (%d: %s %s)", res, m.Name, 1, p.typeName(m.Request), argument))
+		} else {
+			p.buf.WriteString(fmt.Sprintf("%s %s ()", res, m.Name))
+		}
+		p.inlineComment(m.InlineComment)
+		p.buf.WriteString("\n")
+	}
+	p.closing(s.Trivia, s.EndComments, nil)
+}
+
+func (p *thriftPrinter) leading(t Trivia, depth int) {
+	for _, c := range t.Comments {
+		p.comment(c, depth)
+	}
+	for i := 0; i < t.Blank; i++ {
+		p.buf.WriteString("\n")
+	}
+}
+
+// Write comments before the closing brace, the closing brace and annotations of a declaration.
+func (p *thriftPrinter) closing(t Trivia, comments []*Comment, options []*Option) {
+	for _, c := range comments {
+		p.comment(c, 1)
+	}
+	p.buf.WriteString("}")
+	if len(options) > 0 {
+		annotations := []string{}
+		for _, opt := range options {
+			annotations = append(annotations, fmt.Sprintf("%s = %s", opt.Name, opt.Value))
+		}
+		p.buf.WriteString(fmt.Sprintf(" (%s)", strings.Join(annotations, ", ")))
+	}
+	p.inlineComment(t.InlineComment)
+	p.buf.WriteString("\n")
+}
+
+func (p *thriftPrinter) comment(c *Comment, depth int) {
+	for i := 0; i < c.Blank; i++ {
+		p.buf.WriteString("\n")
+	}
+	if !c.Block {
+		for _, line := range c.Lines {
+			p.writeIndent(depth)
+			p.buf.WriteString(fmt.Sprintf("//%s\n", line))
+		}
+		return
+	}
+	p.writeIndent(depth)
+	p.buf.WriteString("/**")
+	// comment already decorated with leading asterisks, e.g. /** ... */, is kept as it is except the indent
+	if last := len(c.Lines) - 1; last > 0 && strings.HasPrefix(c.Lines[0], "*") && strings.TrimSpace(c.Lines[last]) == "" {
+		p.buf.WriteString(c.Lines[0][1:])
+		for _, line := range c.Lines[1:last] {
+			p.buf.WriteString("\n")
+			p.writeIndent(depth)
+			p.buf.WriteString(fmt.Sprintf(" %s", strings.TrimLeft(line, " \t")))
+		}
+		p.buf.WriteString("\n")
+		p.writeIndent(depth)
+		p.buf.WriteString(" */\n")
+		return
+	}
+	for _, line := range c.Lines {
+		p.buf.WriteString("\n")
+		p.writeIndent(depth)
+		p.buf.WriteString(fmt.Sprintf(" *%s", line))
+	}
+	p.buf.WriteString("\n")
+	p.writeIndent(depth)
+	p.buf.WriteString(" */\n")
+}
+
+// Write inline comment after a declaration, block comment is concatenated into one line.
+func (p *thriftPrinter) inlineComment(c *Comment) {
+	if c == nil {
+		return
+	}
+	p.buf.WriteString(" ")
+	if c.Block {
+		p.buf.WriteString("/*")
+		for _, line := range c.Lines {
+			p.buf.WriteString(fmt.Sprintf("%s ", line))
+		}
+		p.buf.WriteString("*/")
+	} else if len(c.Lines) > 0 {
+		p.buf.WriteString(fmt.Sprintf("//%s", c.Lines[0]))
+	}
+}
+
+func (p *thriftPrinter) writeIndent(depth int) {
+	for i := 0; i < depth; i++ {
+		p.buf.WriteString(p.indent)
+	}
+}
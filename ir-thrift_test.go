@@ -0,0 +1,77 @@
+package pbthrift
+
+import (
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/YYCoder/thrifter"
+)
+
+func lowerPrintThrift(t *testing.T, content string) string {
+	t.Helper()
+	def, err := thrifter.NewParser(strings.NewReader(content), false).Parse("INPUT")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(PrintThrift(LowerThrift(def), "\t"))
+}
+
+// The printer always puts a blank line after namespace and above service, blank lines lowered from thrift are kept as
+// well, so runs of blank lines are collapsed before comparing.
+func collapseBlank(s string) string {
+	return regexp.MustCompile(`\n{3,}`).ReplaceAllString(s, "\n\n")
+}
+
+func TestThriftRoundTrip(t *testing.T) {
+	content := `// namespace comment
+namespace * api.user // inline
+
+include "common/base.thrift"
+
+// detached comment
+
+/**
+ * user
+ */
+struct User {
+	// name
+	1: string name
+	2: list<i64> ids // ids
+	3: map<string, base.Base> bases
+}
+
+enum Kind {
+	UNKNOWN = 0
+	ADMIN = 1 // admin
+}
+
+service UserService {
+	// get user
+	User GetUser (1: User req)
+}
+`
+	if got := collapseBlank(lowerPrintThrift(t, content)); got != content {
+		t.Errorf("round trip =\n%s\nwant\n%s", got, content)
+	}
+}
+
+func TestThriftRoundTripExamples(t *testing.T) {
+	paths, err := filepath.Glob("example/*thrift2proto/*.thrift")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// printed output is stable once lowered and printed
+		printed := collapseBlank(lowerPrintThrift(t, string(content)))
+		if got := collapseBlank(lowerPrintThrift(t, printed)); got != printed {
+			t.Errorf("%s round trip =\n%s\nwant\n%s", path, got, printed)
+		}
+	}
+}
@@ -0,0 +1,183 @@
+package pbthrift
+
+// Language-neutral schema of an idl file. Protobuf and thrift files are lowered into it by LowerProto and LowerThrift,
+// transformed by generators, e.g. resolving type references and converting cases, then printed by PrintThrift and
+// PrintProto. Features only available in one language, e.g. protobuf options, thrift typedef, const, union and
+// exception, are not represented.
+type Schema struct {
+	Syntax   int       // protobuf syntax, 2 or 3, 0 if not declared
+	Elements []Element // top level declarations and detached comments, in source order
+}
+
+// Top level element of schema, one of *Package, *Import, *Message, *Enum, *Service and *Comment
+type Element interface {
+	element()
+}
+
+// Layout of the source kept for a declaration
+type Trivia struct {
+	Blank         int        // blank lines right above the declaration, below its comments
+	Comments      []*Comment // leading comments
+	InlineComment *Comment   // comment following the declaration on the same line
+}
+
+type Comment struct {
+	Lines []string // text of each line, without comment markers such as //, # and /* */
+	Block bool     // whether it's a block comment, e.g. /* */
+	Blank int      // blank lines right above the comment
+}
+
+// Protobuf package or thrift namespace
+type Package struct {
+	Trivia
+	Name string
+}
+
+// Protobuf import or thrift include
+type Import struct {
+	Trivia
+	Path string
+	Kind string // weak or public for protobuf import, empty otherwise
+}
+
+// Protobuf message or thrift struct
+type Message struct {
+	Trivia
+	Name        string
+	Fields      []*Field
+	Nested      []Element // nested *Message and *Enum, thrift has no nested declarations
+	Options     []*Option // thrift annotations, protobuf has no equivalent
+	EndComments []*Comment
+}
+
+type Field struct {
+	Trivia
+	Name     string
+	ID       int
+	Type     *Type
+	Optional bool
+}
+
+type Enum struct {
+	Trivia
+	Name        string
+	Values      []*EnumValue
+	Options     []*Option // thrift annotations, protobuf has no equivalent
+	EndComments []*Comment
+}
+
+type EnumValue struct {
+	Trivia
+	Name  string
+	Value int
+}
+
+type Service struct {
+	Trivia
+	Name        string
+	Methods     []*Method
+	EndComments []*Comment
+}
+
+// Protobuf rpc or thrift function, only the first argument of thrift function is kept, since protobuf rpc has exactly
+// one request type.
+type Method struct {
+	Trivia
+	Name     string
+	Argument string // name of the request argument, empty for protobuf
+	Request  *Type  // nil if there is no argument
+	Response *Type  // nil for void
+}
+
+// Thrift annotation, e.g. (go.tag = "json"), value is kept as it's written
+type Option struct {
+	Name  string
+	Value string
+}
+
+// Kinds of type
+const (
+	TypeBase = iota + 1
+	TypeNamed
+	TypeList
+	TypeSet
+	TypeMap
+)
+
+type Type struct {
+	Kind int
+	Name string // base type name for TypeBase, see baseTypes, type reference as it's written for TypeNamed
+	Key  *Type  // key type for TypeMap
+	Elem *Type  // element type for TypeList and TypeSet, value type for TypeMap
+}
+
+func (*Package) element() {}
+func (*Import) element()  {}
+func (*Message) element() {}
+func (*Enum) element()    {}
+func (*Service) element() {}
+func (*Comment) element() {}
+
+// Names of base types, which are the same as protobuf scalar types, thrift byte and i16 are represented as int8 and
+// int16.
+var baseTypes = map[string]bool{
+	"bool":     true,
+	"int8":     true,
+	"int16":    true,
+	"int32":    true,
+	"int64":    true,
+	"uint32":   true,
+	"uint64":   true,
+	"sint32":   true,
+	"sint64":   true,
+	"fixed32":  true,
+	"fixed64":  true,
+	"sfixed32": true,
+	"sfixed64": true,
+	"float":    true,
+	"double":   true,
+	"string":   true,
+	"bytes":    true,
+}
+
+// Return trivia of the declaration, nil for detached comment.
+func triviaOf(e Element) *Trivia {
+	switch e := e.(type) {
+	case *Package:
+		return &e.Trivia
+	case *Import:
+		return &e.Trivia
+	case *Message:
+		return &e.Trivia
+	case *Enum:
+		return &e.Trivia
+	case *Service:
+		return &e.Trivia
+	}
+	return nil
+}
+
+// Set blank lines above the element, including its leading comments.
+func setBlankAbove(e Element, blank int) {
+	if c, ok := e.(*Comment); ok {
+		c.Blank = blank
+		return
+	}
+	t := triviaOf(e)
+	if t == nil {
+		return
+	}
+	if len(t.Comments) > 0 {
+		t.Comments[0].Blank = blank
+	} else {
+		t.Blank = blank
+	}
+}
+
+// Return leading comments of a declaration as detached comments, used when the declaration is dropped.
+func detachComments(t Trivia) (res []Element) {
+	for _, c := range t.Comments {
+		res = append(res, c)
+	}
+	return
+}
@@ -0,0 +1,51 @@
+package pbthrift
+
+// Options of a single file, which are options of RunnerConfig overridden by matching Overrides
+type fileOptions struct {
+	fieldCase      string
+	nameCase       string
+	syntax         int
+	useSpaceIndent bool
+	indentSpace    string
+	nestedTypes    bool
+}
+
+// Return options for the input file, overrides are matched against the same path as in generated header.
+func (g *generator) fileOptions(absPath string) (res fileOptions) {
+	res = fileOptions{
+		fieldCase:      g.conf.FieldCase,
+		nameCase:       g.conf.NameCase,
+		syntax:         g.conf.Syntax,
+		useSpaceIndent: g.conf.UseSpaceIndent,
+		indentSpace:    g.conf.IndentSpace,
+		nestedTypes:    g.conf.NestedTypes,
+	}
+	if len(g.conf.Overrides) == 0 {
+		return
+	}
+	name := g.sourceName(absPath)
+	for _, o := range g.conf.Overrides {
+		if !matchGlob(o.Pattern, name) {
+			continue
+		}
+		if o.FieldCase != "" {
+			res.fieldCase = o.FieldCase
+		}
+		if o.NameCase != "" {
+			res.nameCase = o.NameCase
+		}
+		if o.Syntax != 0 {
+			res.syntax = o.Syntax
+		}
+		if o.UseSpaceIndent != nil {
+			res.useSpaceIndent = *o.UseSpaceIndent
+		}
+		if o.IndentSpace != "" {
+			res.indentSpace = o.IndentSpace
+		}
+		if o.NestedTypes != nil {
+			res.nestedTypes = *o.NestedTypes
+		}
+	}
+	return
+}
@@ -0,0 +1,97 @@
+package pbthrift
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFileOptions(t *testing.T) {
+	yes, no := true, false
+	global := fileOptions{fieldCase: "camelCase", nameCase: "camelCase", syntax: 3, indentSpace: "4", nestedTypes: true}
+	overrides := []Override{
+		{Pattern: "legacy", FieldCase: "snakeCase", NameCase: "snakeCase", UseSpaceIndent: &yes},
+		{Pattern: "legacy/v1/**", FieldCase: "pascalCase", Syntax: 2},
+		{Pattern: "*.thrift", NestedTypes: &no, IndentSpace: "2"},
+		{Pattern: "legacy/v1/keep.thrift", UseSpaceIndent: &no, NestedTypes: &yes},
+	}
+	cases := []struct {
+		path string
+		want fileOptions
+	}{
+		// no override matches
+		{"/idl/api/a.proto", global},
+		{
+			"/idl/legacy/a.proto",
+			fileOptions{fieldCase: "snakeCase", nameCase: "snakeCase", syntax: 3, useSpaceIndent: true, indentSpace: "4", nestedTypes: true},
+		},
+		// later overrides take precedence, options they don't specify are kept
+		{
+			"/idl/legacy/v1/a.proto",
+			fileOptions{fieldCase: "pascalCase", nameCase: "snakeCase", syntax: 2, useSpaceIndent: true, indentSpace: "4", nestedTypes: true},
+		},
+		{
+			"/idl/legacy/v1/a.thrift",
+			fileOptions{fieldCase: "pascalCase", nameCase: "snakeCase", syntax: 2, useSpaceIndent: true, indentSpace: "2"},
+		},
+		// false of bool options overrides true of previous ones
+		{
+			"/idl/legacy/v1/keep.thrift",
+			fileOptions{fieldCase: "pascalCase", nameCase: "snakeCase", syntax: 2, indentSpace: "2", nestedTypes: true},
+		},
+		// pattern without slash matches whole path elements
+		{"/idl/api/legacy.proto", global},
+	}
+	g := &generator{conf: &RunnerConfig{
+		FS:          fstest.MapFS{},
+		InputPath:   "/idl",
+		FieldCase:   global.fieldCase,
+		NameCase:    global.nameCase,
+		Syntax:      global.syntax,
+		IndentSpace: global.indentSpace,
+		NestedTypes: global.nestedTypes,
+		Overrides:   overrides,
+	}}
+	for _, c := range cases {
+		if got := g.fileOptions(c.path); !reflect.DeepEqual(got, c.want) {
+			t.Errorf("fileOptions(%q) = %+v, want %+v", c.path, got, c.want)
+		}
+	}
+}
+
+func TestOverridesOfIncludedFiles(t *testing.T) {
+	files := pipeFiles(t, RunnerConfig{
+		FS: fstest.MapFS{
+			"idl/a.proto":        {Data: []byte("syntax = \"proto3\";\nimport \"legacy/b.proto\";\nmessage user_info {\n\tb_type ref = 1;\n}\n")},
+			"idl/legacy/b.proto": {Data: []byte("syntax = \"proto3\";\nmessage b_type {\n\tstring user_id = 1;\n}\n")},
+		},
+		Task:      TASK_FILE_PROTO2THRIFT,
+		InputPath: "idl/a.proto",
+		OutputDir: "/out",
+		Recursive: true,
+		NameCase:  "pascalCase",
+		FieldCase: "camelCase",
+		Overrides: []Override{
+			{Pattern: "legacy", NameCase: "snakeCase", FieldCase: "snakeCase"},
+		},
+	})
+	// a.thrift refers to the type by the name converted with options of legacy/b.proto
+	want := map[string]string{
+		"a.thrift": `// generated by protobuf-thrift from a.proto; DO NOT EDIT
+
+include "legacy/b.thrift"
+struct UserInfo {
+	1: b.b_type ref
+}
+`,
+		"legacy/b.thrift": `// generated by protobuf-thrift from legacy/b.proto; DO NOT EDIT
+
+struct b_type {
+	1: string user_id
+}
+`,
+	}
+	if !reflect.DeepEqual(files, want) {
+		t.Errorf("files =\n%q\nwant\n%q", files, want)
+	}
+}
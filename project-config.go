@@ -0,0 +1,215 @@
+package pbthrift
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"github.com/YYCoder/protobuf-thrift/utils/logger"
+	"gopkg.in/yaml.v3"
+)
+
+// Names of project config file searched in working directory and its parents, JSON is parsed as YAML
+var ProjectConfigNames = []string{"protobuf-thrift.yaml", "protobuf-thrift.yml", "protobuf-thrift.json"}
+
+// Project config file holding command line options, so that everyone runs the same conversion. Keys not specified
+// keep flag defaults, and flags specified in command line override it.
+type projectConfig struct {
+	Task            string     `yaml:"task"`  // proto2thrift or thrift2proto
+	Input           stringList `yaml:"input"` // a path or a list of paths
+	Output          string     `yaml:"output"`
+	Archive         string     `yaml:"archive"`
+	Summary         string     `yaml:"summary"`
+	Recursive       *bool      `yaml:"recursive"`
+	BreakCycles     *bool      `yaml:"breakCycles"`
+	SkipWeakImports *bool      `yaml:"skipWeakImports"`
+	ImportPaths     []string   `yaml:"importPaths"`
+	ImportRoot      string     `yaml:"importRoot"`
+	UseSpaceIndent  *bool      `yaml:"useSpaceIndent"`
+	IndentSpace     *int       `yaml:"indentSpace"`
+	FieldCase       string     `yaml:"fieldCase"`
+	NameCase        string     `yaml:"nameCase"`
+	NestedTypes     *bool      `yaml:"nestedTypes"`
+	Syntax          *int       `yaml:"syntax"`
+	Concurrency     *int       `yaml:"concurrency"`
+	Cache           *bool      `yaml:"cache"`
+	DeleteStale     *bool      `yaml:"deleteStale"`
+	Force           *bool      `yaml:"force"`
+	Include         []string   `yaml:"include"`
+	Exclude         []string   `yaml:"exclude"`
+	IgnoreFiles     []string   `yaml:"ignoreFiles"`
+
+	Overrides []Override `yaml:"overrides"`
+}
+
+// List of strings which can be a single string in project config
+type stringList []string
+
+func (l *stringList) UnmarshalYAML(value *yaml.Node) error {
+	if value.Kind == yaml.ScalarNode {
+		*l = stringList{value.Value}
+		return nil
+	}
+	return value.Decode((*[]string)(l))
+}
+
+// Flag name and value set from project config
+type flagValue struct {
+	name  string
+	value string
+}
+
+// Load RunnerConfig from project config file, which is the same as running the executable with only -config option.
+// Relative paths in it are resolved against the directory of the file.
+func LoadProjectConfig(path string) (res RunnerConfig, err error) {
+	res, _, err = parseArgs("protobuf-thrift", []string{"-config", path}, false)
+	return
+}
+
+// Return path of project config file, which is specified by -config option, or found in working directory and its
+// parents if search is true. Empty -config option disables the search. Args are parsed by a FlagSet declaring the same flags as flags, so
+// that values of other flags are skipped the same way, nothing is returned if they are invalid, parsing them with flags
+// reports the error.
+func projectConfigPath(flags *flag.FlagSet, args []string, search bool) (res string, err error) {
+	pre := flag.NewFlagSet(flags.Name(), flag.ContinueOnError)
+	pre.SetOutput(io.Discard)
+	flags.VisitAll(func(f *flag.Flag) {
+		if b, isBool := f.Value.(interface{ IsBoolFlag() bool }); isBool && b.IsBoolFlag() {
+			pre.Bool(f.Name, false, "")
+		} else {
+			pre.String(f.Name, "", "")
+		}
+	})
+	if pre.Parse(args) != nil {
+		return "", nil
+	}
+	specified := false
+	pre.Visit(func(f *flag.Flag) {
+		if f.Name == "config" {
+			res, specified = f.Value.String(), true
+		}
+	})
+	if specified || !search {
+		return res, nil
+	}
+
+	var dir string
+	if dir, err = os.Getwd(); err != nil {
+		return
+	}
+	for {
+		for _, name := range ProjectConfigNames {
+			if path := filepath.Join(dir, name); fileExists(nil, path) {
+				return path, nil
+			}
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			return "", nil
+		}
+		dir = parent
+	}
+}
+
+// Set flags by project config file. Values of flags specified multiple times, e.g. import paths, are returned by flag
+// names instead, and overrides are returned too, since they are not flags.
+func applyProjectConfig(flags *flag.FlagSet, path string) (lists map[string][]string, overrides []Override, err error) {
+	config, err := loadProjectConfig(path)
+	if err != nil {
+		return nil, nil, &FileError{Op: "load config", Path: path, Err: err}
+	}
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return
+	}
+	var values []flagValue
+	values, lists = config.flagValues(filepath.Dir(absPath))
+	for _, v := range values {
+		if err = flags.Set(v.name, v.value); err != nil {
+			return nil, nil, &FileError{Op: "load config", Path: path, Err: err}
+		}
+	}
+	overrides = config.Overrides
+	logger.Infof("use config file %v", path)
+	return
+}
+
+func loadProjectConfig(path string) (res *projectConfig, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	res = &projectConfig{}
+	decoder := yaml.NewDecoder(bytes.NewReader(content))
+	// typo in keys should not be ignored silently
+	decoder.KnownFields(true)
+	if err = decoder.Decode(res); errors.Is(err, io.EOF) {
+		err = nil
+	}
+	return
+}
+
+// Return flags set by the config, relative paths are resolved against dir. Values of flags specified multiple times
+// are returned separately, since they should be replaced instead of appended by flags in command line.
+func (c *projectConfig) flagValues(dir string) (res []flagValue, lists map[string][]string) {
+	resolve := func(path string) string {
+		if path == "" || path == "-" || filepath.IsAbs(path) {
+			return path
+		}
+		return filepath.Join(dir, path)
+	}
+	add := func(name string, value string) {
+		if value != "" {
+			res = append(res, flagValue{name: name, value: value})
+		}
+	}
+	addBool := func(name string, value *bool, trueValue string, falseValue string) {
+		if value == nil {
+			return
+		} else if *value {
+			add(name, trueValue)
+		} else {
+			add(name, falseValue)
+		}
+	}
+	addInt := func(name string, value *int) {
+		if value != nil {
+			add(name, strconv.Itoa(*value))
+		}
+	}
+
+	add("t", c.Task)
+	add("o", resolve(c.Output))
+	add("archive", resolve(c.Archive))
+	add("summary", resolve(c.Summary))
+	addBool("r", c.Recursive, "1", "0")
+	addBool("break-cycles", c.BreakCycles, "true", "false")
+	addBool("skip-weak-imports", c.SkipWeakImports, "true", "false")
+	add("import-root", resolve(c.ImportRoot))
+	addBool("use-space-indent", c.UseSpaceIndent, "1", "0")
+	addInt("indent-space", c.IndentSpace)
+	add("field-case", c.FieldCase)
+	add("name-case", c.NameCase)
+	addBool("nested-types", c.NestedTypes, "true", "false")
+	addInt("syntax", c.Syntax)
+	addInt("j", c.Concurrency)
+	addBool("cache", c.Cache, "true", "false")
+	addBool("delete-stale", c.DeleteStale, "true", "false")
+	addBool("force", c.Force, "true", "false")
+	lists = map[string][]string{
+		"include":     c.Include,
+		"exclude":     c.Exclude,
+		"ignore-file": c.IgnoreFiles,
+	}
+	for _, path := range c.Input {
+		lists["i"] = append(lists["i"], resolve(path))
+	}
+	for _, path := range c.ImportPaths {
+		lists["I"] = append(lists["I"], resolve(path))
+	}
+	return
+}
@@ -0,0 +1,86 @@
+package pbthrift
+
+import (
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// Change working dir to a sub dir of a temp dir holding a project config, return path of the config.
+func chdirProjectConfig(t *testing.T) (res string) {
+	t.Helper()
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	res = filepath.Join(root, ProjectConfigNames[0])
+	writeFiles(t, root, map[string]string{ProjectConfigNames[0]: "output: gen\n", "sub/a.proto": ""})
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = os.Chdir(filepath.Join(root, "sub")); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+	return
+}
+
+func TestProjectConfigPath(t *testing.T) {
+	found := chdirProjectConfig(t)
+	cases := []struct {
+		name   string
+		args   []string
+		search bool
+		want   string
+	}{
+		{name: "first", args: []string{"-config", "my.yaml", "-t", "proto2thrift"}, want: "my.yaml"},
+		{name: "after flag with value", args: []string{"-t", "proto2thrift", "-config", "my.yaml"}, want: "my.yaml"},
+		{name: "after bool flag", args: []string{"-force", "-config", "my.yaml"}, want: "my.yaml"},
+		{name: "equal sign", args: []string{"-i", "a.proto", "--config=my.yaml"}, want: "my.yaml"},
+		{name: "disabled", args: []string{"-t", "proto2thrift", "-config="}, want: ""},
+		{name: "value of other flag", args: []string{"-o", "-config", "-t", "proto2thrift"}, want: ""},
+		{name: "invalid args", args: []string{"-unknown", "-config", "my.yaml"}, want: ""},
+		{name: "missing value", args: []string{"-config"}, want: ""},
+		{name: "found in parent", args: []string{"-t", "proto2thrift"}, search: true, want: found},
+		{name: "not searched", args: []string{"-t", "proto2thrift"}, want: ""},
+		{name: "given while searching", args: []string{"-config", "my.yaml"}, search: true, want: "my.yaml"},
+		{name: "disabled while searching", args: []string{"-config="}, search: true, want: ""},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			flags := flag.NewFlagSet("test", flag.ContinueOnError)
+			flags.String("t", "", "")
+			flags.String("i", "", "")
+			flags.String("o", "", "")
+			flags.Bool("force", false, "")
+			flags.String("config", "", "")
+			got, err := projectConfigPath(flags, c.args, c.search)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != c.want {
+				t.Errorf("projectConfigPath(%q) = %q, want %q", c.args, got, c.want)
+			}
+		})
+	}
+}
+
+func TestParseArgsProjectConfig(t *testing.T) {
+	found := chdirProjectConfig(t)
+	args := []string{"-t", "proto2thrift", "-i", "a.proto"}
+	config, err := ParseArgs("test", args)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if config.OutputDir != "" {
+		t.Errorf("OutputDir = %q without -config, want project config not searched", config.OutputDir)
+	}
+	if config, err = ParseArgs("test", append(args, "-config", found)); err != nil {
+		t.Fatal(err)
+	}
+	if want := filepath.Join(filepath.Dir(found), "gen"); config.OutputDir != want {
+		t.Errorf("OutputDir = %q with -config, want %q", config.OutputDir, want)
+	}
+}
@@ -1,54 +1,81 @@
 package pbthrift
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
 	"io"
-	"os"
+	"io/fs"
 	"path/filepath"
 	"sort"
-	"strconv"
 	"strings"
 
 	"github.com/YYCoder/protobuf-thrift/utils"
 	"github.com/YYCoder/protobuf-thrift/utils/logger"
-	"github.com/YYCoder/thrifter"
 	"github.com/emicklei/proto"
 )
 
 type thriftGenerator struct {
 	conf          *ThriftGeneratorConfig
 	def           *proto.Proto
-	file          *os.File
+	file          fs.File
 	thriftContent bytes.Buffer
 	newFiles      []FileInfo
 	syntax        int
+	nestedTypes   map[string]string // full path of types declared in current file => flattened name, e.g. Outer.Inner => OuterInner
+	packageName   string
+
+	imports         []*protoImport          // files included by current file, used to qualify types from them
+	importedFiles   map[string]*protoImport // absolute path => loaded imported file, including indirectly imported files
+	missingIncludes []*Import               // includes for files not imported directly but referred by current file
+	commonIncluded  map[string]bool         // absolute path of common files of include cycles which have been included
+	inCommon        bool                    // whether writing declarations moved to the common file of include cycle
 }
 
-type ThriftGeneratorConfig struct {
-	taskType   int
-	filePath   string // absolute path for current file
-	fileName   string // relative filename including path for file to be generated
-	rawContent string
-	outputDir  string // absolute path for output dir
+// Declarations of an imported proto file, used to resolve type references across files
+type protoImport struct {
+	fileInfo FileInfo
+	alias    string            // thrift include alias, which is the generated file name without extension
+	pkg      string            // proto package
+	types    map[string]string // full path of types declared in it, without package => flattened name
+	imports  []*Import
+}
 
-	useSpaceIndent bool
-	indentSpace    string
-	fieldCase      string
-	nameCase       string
+type ThriftGeneratorConfig struct {
+	TaskType   int
+	FS         fs.FS  // input file system, OS file system is used if it's nil
+	FilePath   string // absolute path for current file
+	FileName   string // relative filename including path for file to be generated
+	RawContent string
+	OutputDir  string // absolute path for output dir
+
+	OutputRootDir string     // absolute path for root output dir, output paths of files found in importPaths are relative to it
+	ImportRoot    string     // absolute path for root dir of the output idl tree, generated import paths are relative to it
+	ImportPaths   []string   // absolute paths for directories to search imported files in
+	cycle         *cycleInfo // not nil if current file is in an include cycle, its types will be moved to the common file
+	// return the broken include cycle containing the file, whose types are moved to the common file, nil if there is not
+	cycleOf func(absPath string) *cycleInfo
+	// options of other files by RunnerConfig.Overrides, e.g. name case of imported files, nil if there is no override
+	fileOptions func(absPath string) fileOptions
+
+	SkipWeakImports bool // skip weak imports instead of converting them to normal includes
+
+	UseSpaceIndent bool
+	IndentSpace    string
+	FieldCase      string
+	NameCase       string
+	NestedTypes    bool // annotate flattened nested types with their enclosing struct
 
 	// pb config
-	syntax int // 2 or 3
+	Syntax int // 2 or 3
 }
 
 func NewThriftGenerator(conf *ThriftGeneratorConfig) (res SubGenerator, err error) {
 	var parser *proto.Parser
-	var file *os.File
+	var file fs.File
 	var content string
 	var syntax int
-	if conf.taskType == TASK_FILE_PROTO2THRIFT {
-		file, err = os.Open(conf.filePath)
+	if conf.TaskType == TASK_FILE_PROTO2THRIFT {
+		file, err = openFile(conf.FS, conf.FilePath)
 		if err != nil {
 			return nil, err
 		}
@@ -56,7 +83,7 @@ func NewThriftGenerator(conf *ThriftGeneratorConfig) (res SubGenerator, err erro
 		parser = proto.NewParser(file)
 
 		// get syntax from file
-		file1, err := os.Open(conf.filePath)
+		file1, err := openFile(conf.FS, conf.FilePath)
 		if err != nil {
 			return nil, err
 		}
@@ -66,9 +93,9 @@ func NewThriftGenerator(conf *ThriftGeneratorConfig) (res SubGenerator, err erro
 			return nil, err
 		}
 		content = string(contentBytes)
-	} else if conf.taskType == TASK_CONTENT_PROTO2THRIFT {
-		content = conf.rawContent
-		rd := strings.NewReader(conf.rawContent)
+	} else if conf.TaskType == TASK_CONTENT_PROTO2THRIFT {
+		content = conf.RawContent
+		rd := strings.NewReader(conf.RawContent)
 		parser = proto.NewParser(rd)
 	}
 
@@ -78,473 +105,511 @@ func NewThriftGenerator(conf *ThriftGeneratorConfig) (res SubGenerator, err erro
 		} else {
 			syntax = 2
 		}
-	} else if conf.syntax != 0 {
-		syntax = conf.syntax
+	} else if conf.Syntax != 0 {
+		syntax = conf.Syntax
 	} else {
 		syntax = 3
 	}
 
 	definition, err := parser.Parse()
 	if err != nil {
-		return
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdl, err)
 	}
 
 	res = &thriftGenerator{
-		conf:   conf,
-		def:    definition,
-		file:   file,
-		syntax: syntax,
+		conf:          conf,
+		def:           definition,
+		file:          file,
+		syntax:        syntax,
+		nestedTypes:   make(map[string]string),
+		importedFiles: make(map[string]*protoImport),
+
+		commonIncluded: make(map[string]bool),
 	}
 	return
 }
 
 func (g *thriftGenerator) FilePath() (res string) {
-	if g.conf.taskType == TASK_CONTENT_PROTO2THRIFT {
+	if g.conf.TaskType == TASK_CONTENT_PROTO2THRIFT {
 		res = ""
 	} else {
-		res = g.conf.filePath
+		res = g.conf.FilePath
 	}
 	return
 }
 
-// Iterate over each declare and convert it to thrift declaration.
+// Lower proto ast into schema, convert each declaration to thrift declaration, then print it.
 func (g *thriftGenerator) Parse() (newFiles []FileInfo, err error) {
-	for _, e := range g.def.Elements {
-		switch e.(type) {
-		case *proto.Package:
-			ele := e.(*proto.Package)
-			g.handleComment(ele.Comment, false, 0)
-			g.handlePackage(ele)
-		case *proto.Import:
-			ele := e.(*proto.Import)
-			g.handleComment(ele.Comment, false, 0)
-			g.handleImport(ele)
-		case *proto.Service:
-			ele := e.(*proto.Service)
-			g.handleComment(ele.Comment, false, 0)
-			g.handleService(ele)
-		case *proto.Message:
-			ele := e.(*proto.Message)
-			g.handleComment(ele.Comment, false, 0)
-			g.handleMessage(ele)
-		case *proto.Enum:
-			ele := e.(*proto.Enum)
-			g.handleComment(ele.Comment, false, 0)
-			g.handleEnum(ele)
-		// syntaxes that thrift does not support, only handle comments.
-		case *proto.Extensions:
-		case *proto.Syntax:
-		case *proto.Option:
-		case *proto.Comment:
-			ele := e.(*proto.Comment)
-			g.handleComment(ele, false, 0)
-		default:
-			// logger.Infof("other: %+v\n", e)
+	schema := LowerProto(g.def)
+	stripGeneratedHeader(schema)
+	collectProtoTypes(g.nestedTypes, "", schema.Elements)
+	for _, e := range schema.Elements {
+		if p, ok := e.(*Package); ok {
+			g.packageName = p.Name
+		}
+	}
+
+	elements := []Element{}
+	for _, e := range schema.Elements {
+		switch e := e.(type) {
+		case *Package:
+			g.handlePackage(e)
+			elements = append(elements, e)
+		case *Import:
+			if g.handleImport(e) {
+				elements = append(elements, e)
+			} else {
+				elements = append(elements, detachComments(e.Trivia)...)
+			}
+		case *Service:
+			g.handleService(e)
+			elements = append(elements, e)
+		case *Message:
+			elements = append(elements, g.handleDeclaration(func() []Element {
+				return g.handleMessage(e, "")
+			})...)
+		case *Enum:
+			elements = append(elements, g.handleDeclaration(func() []Element {
+				return g.handleEnum(e, "")
+			})...)
+		case *Comment:
+			elements = append(elements, e)
 		}
 	}
+	schema.Elements = g.handleMissingIncludes(elements)
+	g.thriftContent.Write(PrintThrift(schema, indentUnit(g.conf.UseSpaceIndent, g.conf.IndentSpace)))
 
 	newFiles = g.newFiles
 	return
 }
 
-// Write thrift code from thriftContent to output.
-func (g *thriftGenerator) Sink() (err error) {
-	if g.conf.outputDir != "" {
-		var file *os.File
-		err = os.MkdirAll(g.conf.outputDir, 0755)
-		if err != nil {
-			logger.Errorf("Error occurred when MkdirAll %v", g.conf.outputDir)
-			return
-		}
-		outputPath := filepath.Join(g.conf.outputDir, g.conf.fileName)
-		file, err = os.Create(outputPath)
-		if err != nil {
-			logger.Errorf("os.Create file %v error %v", outputPath, err)
-			return err
-		}
-		defer file.Close()
-		_, err = file.WriteString(g.thriftContent.String())
-	} else {
-		f := bufio.NewWriter(os.Stdout)
-		defer f.Flush()
-		_, err = f.Write(g.thriftContent.Bytes())
+func (g *thriftGenerator) handlePackage(p *Package) {
+	if g.conf.cycle != nil {
+		g.conf.cycle.setPackage(g.conf.FilePath, p.Name)
 	}
-
 	return
 }
 
-func (g *thriftGenerator) handleComment(ele *proto.Comment, inline bool, indentCount int) (err error) {
-	// since we only want to read comments, let's just assert it to a random type.
-	if ele == nil {
+// Analyze proto import declaration and append it to newFiles in order to recursively parse imported files. Then, convert import declaration to thrift include declaration, return false if it should be dropped.
+func (g *thriftGenerator) handleImport(i *Import) (keep bool) {
+	if g.conf.TaskType != TASK_FILE_PROTO2THRIFT {
 		return
 	}
-	if inline {
-		for i := 0; i < indentCount; i++ {
-			g.writeIndent()
+
+	// thrift has no weak or public include, weak imports are converted to normal includes unless skipped, public imports
+	// are converted to normal includes and expanded in dependants when types from them are referred
+	switch i.Kind {
+	case "weak":
+		if g.conf.SkipWeakImports {
+			logger.Warnf("skip weak import %v in %v", i.Path, g.conf.FilePath)
+			return
 		}
-		if ele.Cstyle {
-			// concat multiple line comment into one line.
-			g.thriftContent.WriteString("/*")
-			for _, line := range ele.Lines {
-				g.thriftContent.WriteString(fmt.Sprintf("%s ", line))
-			}
-			g.thriftContent.WriteString("*/")
-		} else {
-			if ele.ExtraSlash {
-				g.thriftContent.WriteString("/")
-			}
-			g.thriftContent.WriteString(fmt.Sprintf("//%s", ele.Lines[0]))
+		logger.Warnf("weak import %v in %v is converted to normal include", i.Path, g.conf.FilePath)
+	case "public":
+		logger.Infof("public import %v in %v is converted to normal include", i.Path, g.conf.FilePath)
+	}
+	i.Kind = ""
+
+	fileName := strings.ReplaceAll(i.Path, ".proto", ".thrift")
+	// analyze dependency
+	newFile, err := g.resolveImport(g.conf.FilePath, g.conf.OutputDir, i.Path)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+	g.newFiles = append(g.newFiles, newFile)
+	imported := g.loadImport(newFile)
+
+	if moved := g.movedTo(newFile.absPath); moved != nil {
+		// types of files in an include cycle are moved to the common file, include it instead
+		imported.alias = moved.alias()
+		g.imports = append(g.imports, imported)
+		if g.conf.cycle != nil && g.conf.cycle != moved {
+			g.conf.cycle.addInclude(moved.common)
 		}
-	} else {
-		if ele.Cstyle {
-			for i := 0; i < indentCount; i++ {
-				g.writeIndent()
-			}
-			g.thriftContent.WriteString("/**")
-			for _, comment := range ele.Lines {
-				g.thriftContent.WriteString("\n")
-				for i := 0; i < indentCount; i++ {
-					g.writeIndent()
-				}
-				g.thriftContent.WriteString(" *")
-				g.thriftContent.WriteString(comment)
-			}
-			g.thriftContent.WriteString("\n")
-			for i := 0; i < indentCount; i++ {
-				g.writeIndent()
-			}
-			g.thriftContent.WriteString(" */\n")
-		} else {
-			for _, line := range ele.Lines {
-				for i := 0; i < indentCount; i++ {
-					g.writeIndent()
-				}
-				g.thriftContent.WriteString("//")
-				if ele.ExtraSlash {
-					g.thriftContent.WriteString("/")
-				}
-				g.thriftContent.WriteString(line)
-				g.thriftContent.WriteString("\n")
-			}
+		if g.commonIncluded[moved.common.absPath] {
+			return
 		}
+		g.commonIncluded[moved.common.absPath] = true
+		i.Path = includePathFor(g.conf.ImportRoot, filepath.Join(g.conf.OutputDir, g.conf.FileName), moved.common.outputPath)
+		return true
 	}
-	return
+	if g.conf.cycle != nil {
+		g.conf.cycle.addInclude(newFile)
+	}
+
+	// convert import declaration
+	i.Path = importPathFromRoot(g.conf.ImportRoot, newFile.outputPath, fileName)
+	imported.alias = strings.TrimSuffix(filepath.Base(i.Path), ".thrift")
+	g.imports = append(g.imports, imported)
+	return true
 }
 
-func (g *thriftGenerator) handlePackage(p *proto.Package) {
-	g.thriftContent.WriteString(fmt.Sprintf("namespace * %s;\n\n", p.Name))
+// Return enum or message declarations converted by handle, if current file is in an include cycle, they are moved to
+// the common file.
+func (g *thriftGenerator) handleDeclaration(handle func() []Element) (res []Element) {
+	if g.conf.cycle == nil {
+		return handle()
+	}
+	g.inCommon = true
+	g.conf.cycle.elements = append(g.conf.cycle.elements, handle()...)
+	g.inCommon = false
 	return
 }
 
-// Analyze proto import declaration and append it to newFiles in order to recursively parse imported files. Then, convert import declaration to thrift include declaration.
-func (g *thriftGenerator) handleImport(i *proto.Import) {
-	if g.conf.taskType != TASK_FILE_PROTO2THRIFT {
-		return
+// Return the include cycle whose common file holds types of the file, nil if they are not moved.
+func (g *thriftGenerator) movedTo(absPath string) *cycleInfo {
+	if g.conf.cycle != nil && g.conf.cycle.contains(absPath) {
+		return g.conf.cycle
+	}
+	if g.conf.cycleOf != nil {
+		return g.conf.cycleOf(absPath)
 	}
+	return nil
+}
 
-	fileName := strings.ReplaceAll(i.Filename, ".proto", ".thrift")
-	// analyze dependency
-	var newFile FileInfo
-	if filepath.IsAbs(i.Filename) {
-		relPath, err := filepath.Rel(g.conf.filePath, i.Filename)
+// Resolve imported file from the importing file, outputDir is the output dir for importing file.
+func (g *thriftGenerator) resolveImport(importingFile string, outputDir string, filename string) (newFile FileInfo, err error) {
+	fileName := strings.ReplaceAll(filename, ".proto", ".thrift")
+	if absPath, _, found := findInImportPaths(g.conf.FS, g.conf.ImportPaths, filename); found {
+		// same as protoc, imported path is relative to the import path
+		newFile = FileInfo{
+			absPath:    absPath,
+			outputPath: filepath.Join(g.conf.OutputRootDir, fileName),
+			includedBy: importingFile,
+		}
+	} else if filepath.IsAbs(filename) {
+		relPath, err := filepath.Rel(importingFile, filename)
 		if err != nil {
-			logger.Errorf("filepath.Rel %v %v, err %v", g.conf.filePath, i.Filename, err)
-			return
+			return newFile, fmt.Errorf("filepath.Rel %v %v, err %v", importingFile, filename, err)
 		}
 		newFile = FileInfo{
-			absPath:    i.Filename,
-			outputPath: filepath.Join(g.conf.outputDir, strings.ReplaceAll(relPath, ".proto", ".thrift")),
+			absPath:    filename,
+			outputPath: filepath.Join(outputDir, strings.ReplaceAll(relPath, ".proto", ".thrift")),
+			includedBy: importingFile,
 		}
 	} else {
 		newFile = FileInfo{
-			absPath:    filepath.Join(filepath.Dir(g.conf.filePath), i.Filename),
-			outputPath: filepath.Join(g.conf.outputDir, strings.ReplaceAll(i.Filename, ".proto", ".thrift")),
+			absPath:    filepath.Join(filepath.Dir(importingFile), filename),
+			outputPath: filepath.Join(outputDir, fileName),
+			includedBy: importingFile,
 		}
 	}
-	g.newFiles = append(g.newFiles, newFile)
+	return
+}
 
-	// convert import declaration
-	// ! NOTE: thrift include can not using semicolon as end of declaration.
-	g.thriftContent.WriteString(fmt.Sprintf("include \"%s\"\n", fileName))
+func (g *thriftGenerator) handleService(s *Service) {
+	s.Name = utils.CaseConvert(g.conf.NameCase, s.Name)
+	for _, m := range s.Methods {
+		m.Name = utils.CaseConvert(g.conf.NameCase, m.Name)
+		// since protobuf rpc method request argument dont have name, we use a default name 'req'
+		m.Argument = utils.CaseConvert(g.conf.NameCase, "req")
+		m.Request = g.resolveType("", m.Request)
+		m.Response = g.resolveType("", m.Response)
+	}
 }
 
-func (g *thriftGenerator) handleService(s *proto.Service) {
-	name := utils.CaseConvert(g.conf.nameCase, s.Name)
-	g.thriftContent.WriteString(fmt.Sprintf("\nservice %s {\n", name))
-	for _, m := range s.Elements {
-		// if element is a comment
-		comment, ok := m.(*proto.Comment)
-		if ok {
-			g.handleComment(comment, false, 1)
-			continue
-		}
+// Handle protobuf enum declaration, scope is the full path of its enclosing message, empty for top level enum.
+func (g *thriftGenerator) handleEnum(e *Enum, scope string) (res []Element) {
+	e.Options = g.nestedAnnotation(scope, e.Name)
+	e.Name = utils.CaseConvert(g.conf.NameCase, g.nestedTypes[joinTypePath(scope, e.Name)])
+	sort.SliceStable(e.Values, func(i, j int) bool {
+		return e.Values[i].Value < e.Values[j].Value
+	})
+	for _, v := range e.Values {
+		v.Name = utils.CaseConvert(g.conf.FieldCase, v.Name)
+	}
+	return []Element{e}
+}
+
+// Handle protobuf message declaration, scope is the full path of its enclosing message, empty for top level message.
+// Since thrift has no nested declarations, nested enums and messages are flattened and returned after the message, their
+// names are prefixed with outer message name to identify.
+func (g *thriftGenerator) handleMessage(m *Message, scope string) (res []Element) {
+	path := joinTypePath(scope, m.Name)
+	m.Options = g.nestedAnnotation(scope, m.Name)
+	m.Name = utils.CaseConvert(g.conf.NameCase, g.nestedTypes[path])
+	for _, f := range m.Fields {
+		f.Name = utils.CaseConvert(g.conf.FieldCase, f.Name)
+		f.Type = g.resolveType(path, f.Type)
+		f.Optional = g.syntax == 2 && f.Optional
+	}
+	res = []Element{m}
 
-		field := m.(*proto.RPC)
-		// handle comment first, because proto can only parse comment above rpc declaration.
-		if field.Comment != nil {
-			g.handleComment(field.Comment, false, 1)
+	nested := m.Nested
+	m.Nested = nil
+	for _, e := range nested {
+		if e, ok := e.(*Enum); ok {
+			res = append(res, g.handleEnum(e, path)...)
 		}
-		name := utils.CaseConvert(g.conf.nameCase, field.Name)
-		g.writeIndent()
-		g.thriftContent.WriteString(
-			fmt.Sprintf(
-				"%s %s (%d: %s %s)\n",
-				field.ReturnsType,
-				name,
-				1,
-				field.RequestType,
-				// since protobuf rpc method request argument dont have name, we use a default name 'req'
-				utils.CaseConvert(g.conf.nameCase, "req"),
-			),
-		)
-	}
-	g.thriftContent.WriteString("}\n")
+	}
+	for _, e := range nested {
+		if e, ok := e.(*Message); ok {
+			res = append(res, g.handleMessage(e, path)...)
+		}
+	}
+	return
 }
 
-func (g *thriftGenerator) handleEnum(s *proto.Enum) {
-	name := utils.CaseConvert(g.conf.nameCase, s.Name)
-	g.thriftContent.WriteString(fmt.Sprintf("enum %s {\n", name))
-	// since for-range map is random-ordered, we need to sort first, then write
-	valueSlice := []*proto.EnumField{}
-	for _, value := range s.Elements {
-		ele := value.(*proto.EnumField)
-		valueSlice = append(valueSlice, ele)
-	}
-	sort.Slice(valueSlice, func(i, j int) bool {
-		return valueSlice[i].Integer < valueSlice[j].Integer
-	})
-
-	for _, field := range valueSlice {
-		// handle comment above field
-		if field.Comment != nil {
-			g.handleComment(field.Comment, false, 1)
+// Record all enums and messages declared in elements by their full path, nested ones are flattened by prefixing
+// outer message name, so that references to nested types can be converted to the flattened names.
+func collectProtoTypes(types map[string]string, scope string, elements []Element) {
+	for _, ele := range elements {
+		switch e := ele.(type) {
+		case *Enum:
+			types[joinTypePath(scope, e.Name)] = types[scope] + e.Name
+		case *Message:
+			path := joinTypePath(scope, e.Name)
+			types[path] = types[scope] + e.Name
+			collectProtoTypes(types, path, e.Nested)
 		}
+	}
+}
 
-		fieldName := utils.CaseConvert(g.conf.fieldCase, field.Name)
-		g.writeIndent()
-		g.thriftContent.WriteString(fmt.Sprintf("%s = %d", fieldName, field.Integer))
-		// handle comment after field line
-		if field.InlineComment != nil {
-			g.thriftContent.WriteString(" ")
-			g.handleComment(field.InlineComment, true, 0)
+// If nestedTypes option is on, annotate flattened nested type with its enclosing struct and its original name,
+// e.g. (pbthrift.nested = "Outer.Inner"), thrift2proto will regroup it into the enclosing message by it.
+func (g *thriftGenerator) nestedAnnotation(scope string, name string) (res []*Option) {
+	if !g.conf.NestedTypes || scope == "" {
+		return
+	}
+	parent := utils.CaseConvert(g.conf.NameCase, g.nestedTypes[scope])
+	return []*Option{{Name: nestedAnnotation, Value: fmt.Sprintf("\"%s.%s\"", parent, name)}}
+}
+
+// Resolve type references in field type, scope is the full path of the message which field belongs to.
+func (g *thriftGenerator) resolveType(scope string, t *Type) *Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind {
+	case TypeBase:
+		if _, ok := thriftBaseType(t.Name); !ok {
+			// if t is not a thrift base type, e.g. uint32, then we should convert its case, same as name
+			return &Type{Kind: TypeNamed, Name: utils.CaseConvert(g.conf.NameCase, t.Name)}
 		}
-		g.thriftContent.WriteString("\n")
+	case TypeNamed:
+		t.Name = g.fieldTypeConverter(scope, t.Name)
+	default:
+		t.Key = g.resolveType(scope, t.Key)
+		t.Elem = g.resolveType(scope, t.Elem)
 	}
-	g.thriftContent.WriteString("}\n")
+	return t
 }
 
-// Handle protobuf message declaration.
-// 1. use thrifter ast node to simplify generation of thrift code.
-// 2. if it has nested enum or message, will prefix its name with outer message name to identify.
-func (g *thriftGenerator) handleMessage(m *proto.Message) {
-	name := utils.CaseConvert(g.conf.nameCase, m.Name)
-	g.thriftContent.WriteString(fmt.Sprintf("struct %s {\n", name))
-	nestedEnums := []*proto.Enum{}
-	nestedMessages := []*proto.Message{}
-
-	// in case ident is a nested enum or message name, check first.
-	// NOTE: nested fields must declare before other fields refer to them, otherwise it can't be identified.
-	var getIdentFieldName = func(ident string) string {
-		nestedName := utils.CaseConvert(g.conf.fieldCase, fmt.Sprintf("%s%s", m.Name, ident))
-		for _, e := range nestedEnums {
-			if e.Name == nestedName {
-				return nestedName
+// Convert type reference, scope is the full path of the message which field belongs to. Type references are
+// resolved by protobuf scoping rules, searching from the innermost scope to the package root, so that nested types
+// can be converted to the flattened names, and types from imported files can be qualified with the include alias.
+func (g *thriftGenerator) fieldTypeConverter(scope string, t string) (res string) {
+	var candidates []string
+	if strings.HasPrefix(t, ".") {
+		candidates = []string{t[1:]}
+	} else {
+		scope = joinTypePath(g.packageName, scope)
+		for {
+			candidates = append(candidates, joinTypePath(scope, t))
+			if scope == "" {
+				break
 			}
-		}
-		for _, e := range nestedMessages {
-			if e.Name == nestedName {
-				return nestedName
+			if idx := strings.LastIndex(scope, "."); idx >= 0 {
+				scope = scope[:idx]
+			} else {
+				scope = ""
 			}
 		}
-		return ident
-	}
-
-	for _, ele := range m.Elements {
-		var field *thrifter.Field
-		var inlineComment, comment *proto.Comment
-
-		switch ele.(type) {
-		case *proto.NormalField:
-			mes := ele.(*proto.NormalField)
-			inlineComment = mes.InlineComment
-			comment = mes.Comment
-			optional := g.syntax == 2 && mes.Optional
-			field = &thrifter.Field{
-				ID:    mes.Sequence,
-				Ident: mes.Name,
-			}
-			if optional {
-				field.Requiredness = "optional"
-			}
+	}
 
-			if mes.Repeated {
-				t, err := g.typeConverter(mes.Type)
-				if err != nil {
-					logger.Error(err)
-					continue
-				}
-				field.FieldType = &thrifter.FieldType{
-					Type: thrifter.FIELD_TYPE_LIST,
-					List: &thrifter.ListType{
-						Elem: &thrifter.FieldType{
-							Type:  thrifter.FIELD_TYPE_IDENT,
-							Ident: getIdentFieldName(t),
-						},
-					},
-				}
-			} else {
-				t, err := g.typeConverter(mes.Type)
-				if err != nil {
-					logger.Error(err)
-					continue
-				}
-				field.FieldType = &thrifter.FieldType{
-					Type:  thrifter.FIELD_TYPE_IDENT,
-					Ident: getIdentFieldName(t),
-				}
+	for _, fullName := range candidates {
+		if name, ok := lookupProtoType(g.packageName, g.nestedTypes, fullName); ok {
+			if g.conf.cycle != nil && !g.inCommon {
+				// declarations of current file are moved to the common file
+				return fmt.Sprintf("%s.%s", g.conf.cycle.alias(), utils.CaseConvert(g.conf.NameCase, name))
 			}
+			return utils.CaseConvert(g.conf.NameCase, name)
+		}
+		if res, ok := g.resolveImportedType(fullName); ok {
+			return res
+		}
+	}
+	// if t is not found, then we should convert its case, same as name
+	return utils.CaseConvert(g.conf.NameCase, t)
+}
 
-			g.handleField(field, comment, inlineComment)
-		case *proto.MapField:
-			mes, ok := ele.(*proto.MapField)
-			inlineComment = mes.InlineComment
-			comment = mes.Comment
-			if ok {
-				field = &thrifter.Field{
-					ID:    mes.Sequence,
-					Ident: mes.Name,
-				}
-
-				keyType, err := g.basicTypeConverter(mes.KeyType)
-				if err != nil {
-					logger.Errorf("Invalid map key type: %v", mes.KeyType)
-				}
-				valueType, err := g.typeConverter(mes.Type)
-				if err != nil {
-					logger.Errorf("Invalid map value type: %v", mes.Type)
-					return
-				}
+// Find the type declared in imported files, return the type name qualified with include alias. If it's declared in a
+// file not imported by current file directly, e.g. imported by an imported file, the missing include will be added.
+func (g *thriftGenerator) resolveImportedType(fullName string) (res string, ok bool) {
+	var name string
+	for _, imported := range g.imports {
+		if name, ok = lookupProtoType(imported.pkg, imported.types, fullName); ok {
+			return g.importedTypeName(imported, name), true
+		}
+	}
 
-				field.FieldType = &thrifter.FieldType{
-					Type: thrifter.FIELD_TYPE_MAP,
-					Map: &thrifter.MapType{
-						Key: &thrifter.FieldType{
-							Type:  thrifter.FIELD_TYPE_IDENT,
-							Ident: getIdentFieldName(keyType),
-						},
-						Value: &thrifter.FieldType{
-							Type:  thrifter.FIELD_TYPE_IDENT,
-							Ident: getIdentFieldName(valueType),
-						},
-					},
-				}
+	// same as protoc, types from files publicly imported by imported files are visible in current file, since thrift
+	// has no re-export, they are searched first and included directly
+	if res, ok = g.resolveIndirectImportedType(fullName, true); ok {
+		return
+	}
+	return g.resolveIndirectImportedType(fullName, false)
+}
 
-			} else {
-				logger.Errorf("Unknown invalid proto message field: %+v", mes)
+// Search files imported by imported files breadth first, if publicOnly is true, only public imports are followed.
+func (g *thriftGenerator) resolveIndirectImportedType(fullName string, publicOnly bool) (res string, ok bool) {
+	var name string
+	visited := map[string]bool{g.conf.FilePath: true}
+	queue := []*protoImport{}
+	for _, imported := range g.imports {
+		visited[imported.fileInfo.absPath] = true
+		queue = append(queue, imported)
+	}
+	for len(queue) > 0 {
+		var current *protoImport
+		current, queue = queue[0], queue[1:]
+		for _, i := range current.imports {
+			if (publicOnly && i.Kind != "public") || (g.conf.SkipWeakImports && i.Kind == "weak") {
 				continue
 			}
-
-			g.handleField(field, comment, inlineComment)
-		case *proto.Enum:
-			mes := ele.(*proto.Enum)
-			mes.Name = fmt.Sprintf("%s%s", m.Name, mes.Name)
-			nestedEnums = append(nestedEnums, mes)
-		case *proto.Message:
-			mes := ele.(*proto.Message)
-			mes.Name = fmt.Sprintf("%s%s", m.Name, mes.Name)
-			nestedMessages = append(nestedMessages, mes)
+			newFile, err := g.resolveImport(current.fileInfo.absPath, filepath.Dir(current.fileInfo.outputPath), i.Path)
+			if err != nil || visited[newFile.absPath] {
+				continue
+			}
+			visited[newFile.absPath] = true
+			imported := g.loadImport(newFile)
+			if name, ok = lookupProtoType(imported.pkg, imported.types, fullName); ok {
+				if moved := g.movedTo(imported.fileInfo.absPath); moved != nil {
+					imported.alias = moved.alias()
+					if moved != g.conf.cycle {
+						g.addCommonInclude(moved)
+					}
+				} else {
+					if publicOnly {
+						logger.Infof("expand public import %v of %v", i.Path, current.fileInfo.absPath)
+					}
+					g.addMissingInclude(imported)
+				}
+				return g.importedTypeName(imported, name), true
+			}
+			queue = append(queue, imported)
 		}
 	}
+	return
+}
 
-	// done handling message
-	g.thriftContent.WriteString("}\n")
-
-	for _, e := range nestedEnums {
-		g.handleEnum(e)
+// Return type name qualified with include alias, types moved to the common file of include cycle are not qualified
+// inside the common file.
+func (g *thriftGenerator) importedTypeName(imported *protoImport, name string) string {
+	nameCase := g.conf.NameCase
+	if g.conf.fileOptions != nil {
+		nameCase = g.conf.fileOptions(imported.fileInfo.absPath).nameCase
+	}
+	name = utils.CaseConvert(nameCase, name)
+	if g.inCommon && g.conf.cycle.contains(imported.fileInfo.absPath) {
+		return name
 	}
+	return fmt.Sprintf("%s.%s", imported.alias, name)
+}
 
-	for _, e := range nestedMessages {
-		g.handleMessage(e)
+// Add include declaration for a file which is not imported by current file directly.
+func (g *thriftGenerator) addMissingInclude(imported *protoImport) {
+	// keep the same style as imported paths, files in import paths are relative to the root output dir, others are
+	// relative to current file
+	outputDir := filepath.Dir(filepath.Join(g.conf.OutputDir, g.conf.FileName))
+	if _, found := relToImportPaths(g.conf.ImportPaths, imported.fileInfo.absPath); found {
+		outputDir = g.conf.OutputRootDir
+	}
+	fileName, err := filepath.Rel(outputDir, imported.fileInfo.outputPath)
+	if err != nil {
+		fileName = imported.fileInfo.outputPath
+	}
+	fileName = importPathFromRoot(g.conf.ImportRoot, imported.fileInfo.outputPath, filepath.ToSlash(fileName))
+	imported.alias = strings.TrimSuffix(filepath.Base(fileName), ".thrift")
+	imported.fileInfo.includedBy = g.conf.FilePath
+	g.imports = append(g.imports, imported)
+	g.newFiles = append(g.newFiles, imported.fileInfo)
+	g.missingIncludes = append(g.missingIncludes, &Import{Path: fileName})
+	if g.conf.cycle != nil {
+		g.conf.cycle.addInclude(imported.fileInfo)
 	}
+	logger.Infof("add missing include %v to %v", fileName, g.conf.FilePath)
 }
 
-// Convert message field to thrift field type by thrifter Field node.
-func (g *thriftGenerator) handleField(field *thrifter.Field, comment *proto.Comment, inlineComment *proto.Comment) {
-	// convert field type string
-	typeStr := ""
-	switch field.FieldType.Type {
-	case thrifter.FIELD_TYPE_LIST:
-		typeStr = fmt.Sprintf("list<%s>", field.FieldType.List.Elem.Ident)
-	case thrifter.FIELD_TYPE_MAP:
-		typeStr = fmt.Sprintf("map<%s, %s>", field.FieldType.Map.Key.Ident, field.FieldType.Map.Value.Ident)
-	case thrifter.FIELD_TYPE_IDENT:
-		typeStr = field.FieldType.Ident
-	default:
-		logger.Errorf("Unknown thrift field type: %+v", field)
+// Add include declaration for the common file of include cycle, which holds a type referred by current file.
+func (g *thriftGenerator) addCommonInclude(cycle *cycleInfo) {
+	if g.commonIncluded[cycle.common.absPath] {
 		return
 	}
-
-	// handle comment above field
-	if comment != nil {
-		g.handleComment(comment, false, 1)
+	g.commonIncluded[cycle.common.absPath] = true
+	g.missingIncludes = append(g.missingIncludes, &Import{
+		Path: includePathFor(g.conf.ImportRoot, filepath.Join(g.conf.OutputDir, g.conf.FileName), cycle.common.outputPath),
+	})
+	if g.conf.cycle != nil {
+		g.conf.cycle.addInclude(cycle.common)
 	}
+}
 
-	fieldName := utils.CaseConvert(g.conf.fieldCase, field.Ident)
-	g.writeIndent()
-	optStr := ""
-	if field.Requiredness == "optional" {
-		optStr = " optional"
+// Insert missing include declarations after the existing ones, or after the namespace if there is none.
+func (g *thriftGenerator) handleMissingIncludes(elements []Element) (res []Element) {
+	if len(g.missingIncludes) == 0 {
+		return elements
 	}
-	g.thriftContent.WriteString(fmt.Sprintf("%d:%s %s %s", field.ID, optStr, typeStr, fieldName))
-
-	// handle comment after field line
-	if inlineComment != nil {
-		g.thriftContent.WriteString(" ")
-		g.handleComment(inlineComment, true, 0)
+	offset := 0
+	for idx, e := range elements {
+		switch e.(type) {
+		case *Import, *Package:
+			offset = idx + 1
+		}
 	}
-
-	g.thriftContent.WriteString("\n")
+	res = append(res, elements[:offset]...)
+	for _, i := range g.missingIncludes {
+		res = append(res, i)
+	}
+	return append(res, elements[offset:]...)
 }
 
-func (g *thriftGenerator) typeConverter(t string) (res string, err error) {
-	res, err = g.basicTypeConverter(t)
-	if err != nil {
-		// if t is not a basic type, then we should convert its case, same as name
-		res = utils.CaseConvert(g.conf.nameCase, t)
-		return res, nil
+// Load declarations of imported file, files are only parsed once.
+func (g *thriftGenerator) loadImport(fileInfo FileInfo) (res *protoImport) {
+	if res, ok := g.importedFiles[fileInfo.absPath]; ok {
+		return res
 	}
-	return
-}
+	res = &protoImport{
+		fileInfo: fileInfo,
+		types:    make(map[string]string),
+	}
+	g.importedFiles[fileInfo.absPath] = res
 
-func (g *thriftGenerator) basicTypeConverter(t string) (res string, err error) {
-	switch t {
-	case "string":
-		res = "string"
-	case "int64":
-		res = "i64"
-	case "int32":
-		res = "i32"
-	case "float", "double":
-		res = "double"
-	case "bool":
-		res = "bool"
-	// case "bytes":
-	// 	res = "byte"
-	default:
-		err = fmt.Errorf("Invalid basic type %s", t)
+	file, err := openFile(g.conf.FS, fileInfo.absPath)
+	if err != nil {
+		logger.Warnf("Could not open imported file %v, types from it will not be qualified", fileInfo.absPath)
+		return
 	}
+	defer file.Close()
+	definition, err := proto.NewParser(file).Parse()
+	if err != nil {
+		logger.Warnf("Could not parse imported file %v, types from it will not be qualified, %v", fileInfo.absPath, err)
+		return
+	}
+	schema := LowerProto(definition)
+	for _, e := range schema.Elements {
+		switch e := e.(type) {
+		case *Package:
+			res.pkg = e.Name
+		case *Import:
+			res.imports = append(res.imports, e)
+		}
+	}
+	collectProtoTypes(res.types, "", schema.Elements)
 	return
 }
 
-func (g *thriftGenerator) writeIndent() {
-	if g.conf.useSpaceIndent {
-		spaceCount, _ := strconv.Atoi(g.conf.indentSpace)
-		for i := 0; i < spaceCount; i++ {
-			g.thriftContent.WriteString(" ")
+// Find type by its full name in the types declared in package pkg, return its flattened name.
+func lookupProtoType(pkg string, types map[string]string, fullName string) (name string, ok bool) {
+	if pkg != "" {
+		if !strings.HasPrefix(fullName, pkg+".") {
+			return
 		}
-	} else {
-		g.thriftContent.WriteString("	")
+		fullName = fullName[len(pkg)+1:]
 	}
+	name, ok = types[fullName]
+	return
 }
 
 func (g *thriftGenerator) Pipe() (res []byte, err error) {
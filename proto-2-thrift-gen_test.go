@@ -0,0 +1,135 @@
+package pbthrift
+
+import (
+	"testing"
+	"testing/fstest"
+)
+
+// Proto files importing files in another -I path, referring types by relative, package qualified and fully qualified
+// names
+var crossFileProtos = fstest.MapFS{
+	"idl/api/user.proto": {Data: []byte(`syntax = "proto3";
+package api.user;
+
+import "common/base.proto";
+import "api/types.proto";
+
+message User {
+	common.Base base = 1;
+	api.user.Kind kind = 2;
+	.common.Base.Inner inner = 3;
+	Profile profile = 4;
+}
+`)},
+	"idl/api/types.proto": {Data: []byte(`syntax = "proto3";
+package api.user;
+
+enum Kind {
+	A = 0;
+}
+message Profile {
+	string name = 1;
+}
+`)},
+	"vendor/common/base.proto": {Data: []byte(`syntax = "proto3";
+package common;
+
+message Base {
+	message Inner {
+		int32 id = 1;
+	}
+	string id = 1;
+}
+`)},
+}
+
+func TestProto2ThriftCrossFileReferences(t *testing.T) {
+	cases := []struct {
+		name       string
+		importRoot string
+		want       map[string]string
+	}{
+		{
+			name: "import paths as written",
+			want: map[string]string{
+				"api/user.thrift": `// generated by protobuf-thrift from api/user.proto; DO NOT EDIT
+
+namespace * api.user
+
+include "common/base.thrift"
+include "api/types.thrift"
+struct User {
+	1: base.Base base
+	2: types.Kind kind
+	3: base.BaseInner inner
+	4: types.Profile profile
+}
+`,
+				"api/types.thrift": `// generated by protobuf-thrift from api/types.proto; DO NOT EDIT
+
+namespace * api.user
+
+enum Kind {
+	a = 0
+}
+struct Profile {
+	1: string name
+}
+`,
+				"common/base.thrift": `// generated by protobuf-thrift from common/base.proto; DO NOT EDIT
+
+namespace * common
+
+struct Base {
+	1: string id
+}
+struct BaseInner {
+	1: i32 id
+}
+`,
+			},
+		},
+		{
+			name:       "import paths relative to import root",
+			importRoot: "/out",
+			want: map[string]string{
+				"api/user.thrift": `// generated by protobuf-thrift from api/user.proto; DO NOT EDIT
+
+namespace * api.user
+
+include "gen/common/base.thrift"
+include "gen/api/types.thrift"
+struct User {
+	1: base.Base base
+	2: types.Kind kind
+	3: base.BaseInner inner
+	4: types.Profile profile
+}
+`,
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			files := pipeFiles(t, RunnerConfig{
+				FS:          crossFileProtos,
+				Task:        TASK_FILE_PROTO2THRIFT,
+				InputPath:   "idl/api/user.proto",
+				OutputDir:   "/out/gen",
+				Recursive:   true,
+				ImportPaths: []string{"idl", "vendor"},
+				ImportRoot:  c.importRoot,
+				NameCase:    "pascalCase",
+				FieldCase:   "snakeCase",
+			})
+			if len(files) != 3 {
+				t.Errorf("converted files = %d, want 3", len(files))
+			}
+			for path, want := range c.want {
+				if got := files[path]; got != want {
+					t.Errorf("%s =\n%s\nwant\n%s", path, got, want)
+				}
+			}
+		})
+	}
+}
@@ -1,11 +1,16 @@
 package pbthrift
 
 import (
+	"compress/gzip"
 	"flag"
+	"fmt"
 	"io"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"strconv"
+	"strings"
+	"time"
 
 	"github.com/YYCoder/protobuf-thrift/utils/logger"
 )
@@ -17,107 +22,474 @@ const (
 	TASK_CONTENT_THRIFT2PROTO
 )
 
+// Version of protobuf-thrift, cache of other versions is discarded, since converted files may differ
+const Version = "0.4.0"
+
 type Runner struct {
-	Config *RunnerConfig
+	Config  *RunnerConfig
+	closers []io.Closer // resources created by NewRunner, closed by Close
+	// keep converting files when they change, set by -watch option of NewRunner, see Watch
+	watch         bool
+	watchInterval time.Duration
+	check         bool // compare converted files with output dir instead of writing them, set by -check option, see Check
+	dryRun        bool // print planned outputs instead of writing them, set by -dry-run option, see DryRun
 }
 
 type RunnerConfig struct {
 	Pipe       bool // return the result from Generator instead of printing to os.Stdout or filesystem
 	RawContent string
-	InputPath  string // absolute path for input idl file
-	OutputDir  string // absolute path for output dir
-	Task       int
-	Recursive  bool // recursive parse file with imported files
+	// input file system, InputPath, InputPaths and ImportPaths are relative to its root, OS file system is used if it's nil
+	FS        fs.FS
+	InputPath string // absolute path for input idl file or dir
+	OutputDir string // absolute path for output dir
+	// more input files, dirs or glob patterns converted in the same run as InputPath, they share the dependency graph,
+	// so that files imported by several inputs are converted once. Globs are expanded by validation, ** matches any
+	// number of dirs, output paths of files matched by them are relative to their static roots
+	InputPaths []string
+	// absolute path of each input matched by glob pattern => static root of the pattern, set by validation
+	inputRoots map[string]string
+	// destination for converted files, if it's nil, files are written into OutputDir, or os.Stdout if OutputDir is empty
+	Sink Sink
+	// if it's not nil, output paths of written files relative to OutputDir are written to it after generation, sorted, so
+	// that it's stable between runs
+	Summary   io.Writer
+	Task      int
+	Recursive bool // recursive parse file with imported files
+	// break include cycles by moving types of files in each cycle to a generated common file, otherwise report them as error
+	BreakCycles bool
+	// skip proto weak imports instead of converting them to normal includes, since thrift has no weak include
+	SkipWeakImports bool
+	// absolute paths for directories to search imported files in, like protoc -I/--proto_path. Output paths of files
+	// found in them are relative to the matched directory
+	ImportPaths []string
+	ImportRoot  string // absolute path for root dir of the output idl tree, generated import paths are relative to it
+	// maximum count of files parsed or written at the same time, 0 means 1, which parses and writes files one by one.
+	// Converted files are the same whatever it is, but log lines are in order only when files are handled one by one
+	Concurrency int
+	// skip files not changed since the last run, including files included by them transitively, by a cache manifest in
+	// OutputDir. It's only available when files are written into OutputDir
+	Cache bool
+	// delete outputs of the last run recorded in cache manifest, whose input files are not converted any more
+	DeleteStale bool
+	// overwrite or delete files in OutputDir without generated header, which are refused by default to protect
+	// hand-written files
+	Force bool
 
 	UseSpaceIndent bool
 	IndentSpace    string
 	FieldCase      string
 	NameCase       string
+	NestedTypes    bool // keep nested type relationship between protobuf nested types and flattened thrift types
 
 	// pb config
 	Syntax int // 2 or 3
+
+	// options for input files matching glob patterns, applied in order, so later ones take precedence
+	Overrides []Override
+
+	// glob patterns of idl files converted in input dir and recursive mode, all files are converted if it's empty.
+	// Patterns are matched against the path relative to the matched import path or input dir, see header of generated
+	// files. Pattern without slash matches any element of the path, e.g. *.proto or vendor, other patterns match the
+	// path or one of its parent dirs from the beginning, and ** matches any number of dirs, e.g. legacy/**/*.thrift.
+	// Exclude and Override use the same syntax.
+	Include []string
+	// glob patterns of idl files or dirs not converted in input dir and recursive mode, e.g. google/protobuf or testdata
+	Exclude []string
+	// names of ignore files honoured in every directory besides IgnoreFileName, e.g. .gitignore
+	IgnoreFiles []string
 }
 
+// Options overriding RunnerConfig for input files matching Pattern, see RunnerConfig.Include for the syntax. Zero values
+// keep options of RunnerConfig.
+type Override struct {
+	Pattern        string `yaml:"pattern" json:"pattern"` // e.g. *.thrift, legacy or legacy/**/*.thrift
+	FieldCase      string `yaml:"fieldCase" json:"fieldCase,omitempty"`
+	NameCase       string `yaml:"nameCase" json:"nameCase,omitempty"`
+	Syntax         int    `yaml:"syntax" json:"syntax,omitempty"`
+	UseSpaceIndent *bool  `yaml:"useSpaceIndent" json:"useSpaceIndent,omitempty"`
+	IndentSpace    string `yaml:"indentSpace" json:"indentSpace,omitempty"`
+	NestedTypes    *bool  `yaml:"nestedTypes" json:"nestedTypes,omitempty"`
+}
+
+// Create Runner from command line arguments and stdin of current process, used by the executable.
 func NewRunner() (res *Runner, err error) {
-	var rawContent, inputPath, outputDir, taskType, useSpaceIndent, indentSpace string
+	var config RunnerConfig
+	var opts cliOptions
+	if config, opts, err = parseArgs(os.Args[0], os.Args[1:], true); err != nil {
+		return
+	}
+
+	// read rawContent from stdin directly
+	if config.Task == TASK_CONTENT_PROTO2THRIFT || config.Task == TASK_CONTENT_THRIFT2PROTO {
+		logger.Info("Paste your original idl here, then press Ctrl+D to continue =>")
+
+		var bytes []byte
+		if bytes, err = io.ReadAll(os.Stdin); err != nil {
+			return
+		}
+
+		logger.Info("Converting...")
+		config.RawContent = string(bytes)
+	}
+
+	if opts.watch && opts.archive != "" {
+		return nil, &OptionError{Option: "watch", Value: "true", Reason: "it can not be used with archive"}
+	}
+	if opts.check && (opts.watch || opts.archive != "") {
+		return nil, &OptionError{Option: "check", Value: "true", Reason: "it can not be used with watch or archive"}
+	}
+	if opts.dryRun && (opts.check || opts.watch || opts.archive != "") {
+		return nil, &OptionError{Option: "dry-run", Value: "true", Reason: "it can not be used with check, watch or archive"}
+	}
+	if res, err = NewRunnerWithConfig(config); err != nil {
+		return
+	}
+	res.watch, res.watchInterval, res.check, res.dryRun = opts.watch, opts.watchInterval, opts.check, opts.dryRun
+	if opts.archive != "" {
+		if res.Config.Sink, res.closers, err = newArchiveSink(opts.archive); err != nil {
+			return
+		}
+	}
+	switch opts.summary {
+	case "":
+	case "-":
+		res.Config.Summary = os.Stdout
+	default:
+		var file *os.File
+		if file, err = os.Create(opts.summary); err != nil {
+			return
+		}
+		res.Config.Summary = file
+		res.closers = append(res.closers, file)
+	}
+	return
+}
+
+// Create archive sink writing to file path, the format is decided by its extension.
+func newArchiveSink(path string) (res Sink, closers []io.Closer, err error) {
+	var w io.WriteCloser
+	var sink *ArchiveSink
+	switch {
+	case strings.HasSuffix(path, ".zip"):
+		if w, err = os.Create(path); err == nil {
+			sink = NewZipSink(w)
+		}
+	case strings.HasSuffix(path, ".tar"):
+		if w, err = os.Create(path); err == nil {
+			sink = NewTarSink(w)
+		}
+	case strings.HasSuffix(path, ".tar.gz"), strings.HasSuffix(path, ".tgz"):
+		var file *os.File
+		if file, err = os.Create(path); err == nil {
+			w = gzip.NewWriter(file)
+			sink = NewTarSink(w)
+			closers = append(closers, file)
+		}
+	default:
+		return nil, nil, &OptionError{Option: "archive", Value: path, Reason: "available formats: .zip, .tar, .tar.gz, .tgz"}
+	}
+	if err != nil {
+		return
+	}
+	// close in order: archive, then the writers under it
+	closers = append([]io.Closer{sink, w}, closers...)
+	return sink, closers, nil
+}
+
+// Parse command line arguments into RunnerConfig, flags are declared on a new FlagSet rather than the global one.
+// Project config file is only loaded if -config option is given, it's not searched in working directory.
+func ParseArgs(name string, args []string) (config RunnerConfig, err error) {
+	config, _, err = parseArgs(name, args, false)
+	return
+}
+
+// Options only available for command line, which create resources owned by Runner
+type cliOptions struct {
+	archive       string // path for the archive to write converted files into
+	summary       string // path for the summary file, - for stdout
+	watch         bool
+	watchInterval time.Duration
+	check         bool
+	dryRun        bool
+}
+
+// Parse arguments into RunnerConfig and options only available for command line, project config file is searched in
+// working directory and its parents if search is true and -config option is not given.
+func parseArgs(name string, args []string, search bool) (config RunnerConfig, opts cliOptions, err error) {
+	var outputDir, taskType, useSpaceIndent, indentSpace string
 	var nameCase, fieldCase string
 	var syntaxStr, recursiveStr string
+	var nestedTypes, breakCycles, skipWeakImports bool
+	var inputPaths, importPaths, include, exclude, ignoreFiles stringsFlag
+	var importRoot string
+	var concurrency int
+	var cache, deleteStale, force bool
 
-	// flags declaration using flag package
-	flag.StringVar(&taskType, "t", "", "proto => thrift or thrift => proto, valid values proto2thrift and thrift2proto")
-	flag.StringVar(&inputPath, "i", "", "The idl's file path or directory, if is a directory, it will iterate all idl files")
-	flag.StringVar(&outputDir, "o", "", "The output idl dir path")
-	flag.StringVar(&recursiveStr, "r", "0", "Recursive parse file with imported files")
-	flag.StringVar(&useSpaceIndent, "use-space-indent", "0", "Use space for indent rather than tab")
-	flag.StringVar(&indentSpace, "indent-space", "4", "The space count for each indent")
-	flag.StringVar(&fieldCase, "field-case", "camelCase", "Text case for enum field and message or struct field, available options: camelCase, snakeCase, kababCase, pascalCase, screamingSnakeCase")
-	flag.StringVar(&nameCase, "name-case", "camelCase", "Text case for enum and message or struct name, available options: camelCase, snakeCase, kababCase, pascalCase, screamingSnakeCase")
-	flag.StringVar(&syntaxStr, "syntax", "3", "Syntax for generated protobuf idl")
-
-	flag.Parse() // after declaring flags we need to call it
-
-	flag.Usage = func() {
-		flag.PrintDefaults()
-	}
-
-	// validate cli params
-	ValidateTaskType(taskType)
-	ValidateIndentSpace(indentSpace)
-	syntax := ValidateSyntax(syntaxStr)
-	recursive := ValidateRecursive(recursiveStr)
-	spaceIndent := useSpaceIndent == "1"
+	flags := flag.NewFlagSet(name, flag.ContinueOnError)
+	flags.StringVar(&taskType, "t", "", "proto => thrift or thrift => proto, valid values proto2thrift and thrift2proto")
+	flags.Var(&inputPaths, "i", "The idl's file path, directory or glob pattern, if is a directory, it will iterate all idl files, can be specified multiple times to convert them in one run, ** in glob pattern matches any number of directories")
+	flags.StringVar(&outputDir, "o", "", "The output idl dir path")
+	flags.StringVar(&opts.archive, "archive", "", "Write converted files into an archive instead of the output dir, paths in it are relative to the output dir, available formats: .zip, .tar, .tar.gz, .tgz")
+	flags.StringVar(&opts.summary, "summary", "", "Write a summary of written files to the path after conversion, - for stdout, paths in it are relative to the output dir and sorted")
+	flags.BoolVar(&opts.watch, "watch", false, "Keep running and convert files again when input files or files they import or include change, only changed files and files depending on them are converted")
+	flags.DurationVar(&opts.watchInterval, "watch-interval", DefaultWatchInterval, "Interval for polling input files in watch mode")
+	flags.BoolVar(&opts.check, "check", false, "Convert files in memory and compare them with files in the output dir, print unified diff and exit with error if any of them is out of date, nothing is written")
+	flags.BoolVar(&opts.dryRun, "dry-run", false, "Print every input file, its output path, and whether the output would be created, changed, left alone or refused, nothing is written")
+	flags.StringVar(&recursiveStr, "r", "0", "Recursive parse file with imported files")
+	flags.BoolVar(&breakCycles, "break-cycles", false, "Break include cycles found in recursive mode by moving types of files in each cycle to a generated common file, otherwise they will be reported as error")
+	flags.BoolVar(&skipWeakImports, "skip-weak-imports", false, "Skip weak imports in proto2thrift, otherwise they will be converted to normal includes, weak imports are reported either way")
+	flags.Var(&importPaths, "I", "The directory in which to search for imports or includes, can be specified multiple times, directories will be searched in order")
+	flags.Var(&importPaths, "proto_path", "Same as -I")
+	flags.Var(&include, "include", "Glob pattern of idl files converted in input dir and recursive mode, matched against the path in generated header, can be specified multiple times")
+	flags.Var(&exclude, "exclude", "Glob pattern of idl files or dirs not converted in input dir and recursive mode, e.g. google/protobuf, can be specified multiple times")
+	flags.Var(&ignoreFiles, "ignore-file", "Name of ignore file in .gitignore format honoured in every dir besides .protobuf-thrift-ignore, e.g. .gitignore, can be specified multiple times")
+	flags.StringVar(&importRoot, "import-root", "", "The root dir of the output idl tree, usually the -I path for generated idl, generated import or include paths will be relative to it")
+	flags.IntVar(&concurrency, "j", 1, "Maximum count of files parsed or written at the same time, converted files are the same whatever it is, but log lines are in order only with 1")
+	flags.BoolVar(&cache, "cache", false, "Skip files not changed since the last run, including files they import or include, by a cache manifest in the output dir")
+	flags.BoolVar(&deleteStale, "delete-stale", false, "Delete outputs of the last run whose input files are not converted any more, it requires -cache")
+	flags.BoolVar(&force, "force", false, "Overwrite or delete files in the output dir without the header of generated files, which are refused by default to protect hand-written files")
+	flags.StringVar(&useSpaceIndent, "use-space-indent", "0", "Use space for indent rather than tab")
+	flags.StringVar(&indentSpace, "indent-space", "4", "The space count for each indent")
+	flags.StringVar(&fieldCase, "field-case", "camelCase", "Text case for enum field and message or struct field, available options: camelCase, snakeCase, kababCase, pascalCase, screamingSnakeCase")
+	flags.StringVar(&nameCase, "name-case", "camelCase", "Text case for enum and message or struct name, available options: camelCase, snakeCase, kababCase, pascalCase, screamingSnakeCase")
+	flags.StringVar(&syntaxStr, "syntax", "3", "Syntax for generated protobuf idl")
+	flags.BoolVar(&nestedTypes, "nested-types", false, "Keep nested types, proto2thrift will annotate flattened nested types with their enclosing struct, thrift2proto will regroup annotated types into nested declarations, or OuterInner named types in files without annotations, which nests any type prefixed by another struct name, e.g. UserRequest into User")
+
+	flags.String("config", "", "Path of project config file holding these options in YAML or JSON, flags in command line override it, protobuf-thrift.yaml, protobuf-thrift.yml or protobuf-thrift.json in working directory or its parents is used by default, empty value disables it")
+
+	// options of project config are set before parsing, so that flags in command line override them
+	var configPath string
+	var configLists map[string][]string
+	var overrides []Override
+	if configPath, err = projectConfigPath(flags, args, search); err != nil {
+		return
+	}
+	if configPath != "" {
+		if configLists, overrides, err = applyProjectConfig(flags, configPath); err != nil {
+			return
+		}
+	}
+	if err = flags.Parse(args); err != nil {
+		return
+	}
+	// lists in project config are replaced by flags in command line instead of appended
+	visited := map[string]bool{}
+	flags.Visit(func(f *flag.Flag) {
+		visited[f.Name] = true
+	})
+	if !visited["i"] {
+		inputPaths = configLists["i"]
+	}
+	if !visited["I"] && !visited["proto_path"] {
+		importPaths = configLists["I"]
+	}
+	if !visited["include"] {
+		include = configLists["include"]
+	}
+	if !visited["exclude"] {
+		exclude = configLists["exclude"]
+	}
+	if !visited["ignore-file"] {
+		ignoreFiles = configLists["ignore-file"]
+	}
+
+	// validate cli params, the others are validated by NewRunnerWithConfig
+	if err = ValidateTaskType(taskType); err != nil {
+		return
+	}
+	syntax, err := ValidateSyntax(syntaxStr)
+	if err != nil {
+		return
+	}
+	recursive, err := ValidateRecursive(recursiveStr)
+	if err != nil {
+		return
+	}
 	var task int
 	if taskType == "proto2thrift" {
-		if inputPath != "" {
+		if len(inputPaths) > 0 {
 			task = TASK_FILE_PROTO2THRIFT
 		} else {
 			task = TASK_CONTENT_PROTO2THRIFT
 		}
 	} else if taskType == "thrift2proto" {
-		if inputPath != "" {
+		if len(inputPaths) > 0 {
 			task = TASK_FILE_THRIFT2PROTO
 		} else {
 			task = TASK_CONTENT_THRIFT2PROTO
 		}
 	}
-	if task == TASK_FILE_PROTO2THRIFT || task == TASK_FILE_THRIFT2PROTO {
-		inputPath, outputDir = ValidateInputAndOutput(inputPath, outputDir)
+
+	config = RunnerConfig{
+		OutputDir:       outputDir,
+		UseSpaceIndent:  useSpaceIndent == "1",
+		IndentSpace:     indentSpace,
+		FieldCase:       fieldCase,
+		NameCase:        nameCase,
+		NestedTypes:     nestedTypes,
+		Task:            task,
+		Syntax:          syntax,
+		Recursive:       recursive,
+		BreakCycles:     breakCycles,
+		SkipWeakImports: skipWeakImports,
+		ImportPaths:     importPaths,
+		ImportRoot:      importRoot,
+		Concurrency:     concurrency,
+		Cache:           cache,
+		DeleteStale:     deleteStale,
+		Force:           force,
+		Overrides:       overrides,
+		Include:         include,
+		Exclude:         exclude,
+		IgnoreFiles:     ignoreFiles,
+	}
+	if len(inputPaths) > 0 {
+		config.InputPath, config.InputPaths = inputPaths[0], inputPaths[1:]
 	}
+	return
+}
 
-	// read rawContent from stdin directly
-	if task == TASK_CONTENT_PROTO2THRIFT || task == TASK_CONTENT_THRIFT2PROTO {
-		logger.Info("Paste your original idl here, then press Ctrl+D to continue =>")
+// Create Runner from config, zero values of IndentSpace, FieldCase, NameCase, Syntax and Concurrency are filled with the same
+// defaults as command line flags, relative paths are resolved against current working directory. Config is copied, so
+// it can be reused and runners can be created and run concurrently.
+func NewRunnerWithConfig(config RunnerConfig) (res *Runner, err error) {
+	if err = config.validate(); err != nil {
+		return
+	}
+	res = &Runner{
+		Config: &config,
+	}
+	return
+}
 
-		var bytes []byte
-		bytes, err = io.ReadAll(os.Stdin)
-		if err != nil {
-			logger.Errorf("read data from stdin error %v", err)
+func (o *Override) validate() (err error) {
+	if err = validateGlob("overrides.pattern", o.Pattern); err != nil {
+		return
+	}
+	if o.FieldCase != "" {
+		if err = ValidateCase("field-case", o.FieldCase); err != nil {
 			return
 		}
+	}
+	if o.NameCase != "" {
+		if err = ValidateCase("name-case", o.NameCase); err != nil {
+			return
+		}
+	}
+	if o.Syntax != 0 && o.Syntax != 2 && o.Syntax != 3 {
+		return &OptionError{Option: "syntax", Value: strconv.Itoa(o.Syntax), Reason: "it must be 2 or 3"}
+	}
+	if o.IndentSpace != "" {
+		err = ValidateIndentSpace(o.IndentSpace)
+	}
+	return
+}
 
-		logger.Info("Converting...")
-		rawContent = string(bytes)
+// Validate config and fill default values.
+func (c *RunnerConfig) validate() (err error) {
+	switch c.Task {
+	case TASK_FILE_PROTO2THRIFT, TASK_FILE_THRIFT2PROTO, TASK_CONTENT_PROTO2THRIFT, TASK_CONTENT_THRIFT2PROTO:
+	default:
+		return &OptionError{Option: "t", Value: strconv.Itoa(c.Task), Reason: "it must be one of TASK_* constants"}
 	}
 
-	config := &RunnerConfig{
-		RawContent:     rawContent,
-		InputPath:      inputPath,
-		OutputDir:      outputDir,
-		UseSpaceIndent: spaceIndent,
-		IndentSpace:    indentSpace,
-		FieldCase:      fieldCase,
-		NameCase:       nameCase,
-		Task:           task,
-		Syntax:         syntax,
-		Recursive:      recursive,
+	if c.IndentSpace == "" {
+		c.IndentSpace = "4"
 	}
-	res = &Runner{
-		Config: config,
+	if c.FieldCase == "" {
+		c.FieldCase = "camelCase"
+	}
+	if c.NameCase == "" {
+		c.NameCase = "camelCase"
+	}
+	if c.Syntax == 0 {
+		c.Syntax = 3
+	}
+	if c.Concurrency == 0 {
+		c.Concurrency = 1
+	}
+	if err = ValidateIndentSpace(c.IndentSpace); err != nil {
+		return
+	}
+	if err = ValidateCase("field-case", c.FieldCase); err != nil {
+		return
+	}
+	if err = ValidateCase("name-case", c.NameCase); err != nil {
+		return
+	}
+	if c.DeleteStale && !c.Cache {
+		return &OptionError{Option: "delete-stale", Value: "true", Reason: "it requires cache"}
+	}
+	if c.Concurrency < 0 {
+		return &OptionError{Option: "j", Value: strconv.Itoa(c.Concurrency), Reason: "it must not be negative"}
+	}
+	if c.Syntax != 2 && c.Syntax != 3 {
+		return &OptionError{Option: "syntax", Value: strconv.Itoa(c.Syntax), Reason: "it must be 2 or 3"}
+	}
+	for _, o := range c.Overrides {
+		if err = o.validate(); err != nil {
+			return
+		}
+	}
+	for _, pattern := range c.Include {
+		if err = validateGlob("include", pattern); err != nil {
+			return
+		}
+	}
+	for _, pattern := range c.Exclude {
+		if err = validateGlob("exclude", pattern); err != nil {
+			return
+		}
+	}
+	for _, name := range c.IgnoreFiles {
+		if name == "" || strings.ContainsAny(name, `/\`) {
+			return &OptionError{Option: "ignore-file", Value: name, Reason: "it must be a file name"}
+		}
+	}
+
+	if c.Task == TASK_FILE_PROTO2THRIFT || c.Task == TASK_FILE_THRIFT2PROTO {
+		var inputPaths []string
+		if inputPaths, c.inputRoots, err = expandInputPaths(c.FS, c.inputPaths()); err != nil {
+			return
+		}
+		c.InputPath, c.InputPaths = "", nil
+		if len(inputPaths) > 0 {
+			c.InputPath, c.InputPaths = inputPaths[0], inputPaths[1:]
+		}
+		if c.InputPath, c.OutputDir, err = ValidateInputAndOutput(c.InputPath, c.OutputDir); err != nil {
+			return
+		}
+		if c.ImportPaths, err = validateImportPaths(c.FS, c.ImportPaths); err != nil {
+			return
+		}
+		if c.ImportRoot, err = ValidateImportRoot(c.ImportRoot, c.OutputDir); err != nil {
+			return
+		}
 	}
 	return
 }
 
+// Close resources created by NewRunner, e.g. the archive file, it must be called after Run to finish the archive.
+func (r *Runner) Close() (err error) {
+	for _, c := range r.closers {
+		if closeErr := c.Close(); closeErr != nil && err == nil {
+			err = closeErr
+		}
+	}
+	r.closers = nil
+	return
+}
+
 func (r *Runner) Run() (err error) {
+	if r.watch {
+		return r.Watch(r.watchInterval, nil)
+	}
+	if r.check {
+		return r.Check(os.Stdout)
+	}
+	if r.dryRun {
+		return r.DryRun(os.Stdout)
+	}
 	var generator Generator
 	generator, err = NewGenerator(r.Config)
 	if err != nil {
@@ -127,6 +499,17 @@ func (r *Runner) Run() (err error) {
 	return
 }
 
+// Return all converted files without writing them to filesystem, including imported files in recursive mode.
+func (r *Runner) PipeAll() (res []GeneratedFile, err error) {
+	var generator Generator
+	generator, err = NewGenerator(r.Config)
+	if err != nil {
+		return
+	}
+	res, err = generator.PipeAll()
+	return
+}
+
 func (r *Runner) Pipe() (res []byte, err error) {
 	var generator Generator
 	generator, err = NewGenerator(r.Config)
@@ -137,67 +520,115 @@ func (r *Runner) Pipe() (res []byte, err error) {
 	return
 }
 
-func ValidateTaskType(taskType string) {
+func ValidateTaskType(taskType string) (err error) {
 	if taskType != "proto2thrift" && taskType != "thrift2proto" {
-		logger.Fatal("You must specify which task you want to run, proto2thrift or thrift2proto.")
+		err = &OptionError{Option: "t", Value: taskType, Reason: "you must specify which task you want to run, proto2thrift or thrift2proto"}
 	}
+	return
 }
 
-func ValidateInputAndOutput(inputPath string, outputDir string) (inputAbs string, outputAbs string) {
+func ValidateInputAndOutput(inputPath string, outputDir string) (inputAbs string, outputAbs string, err error) {
 	if inputPath != "" && outputDir == "" {
-		logger.Fatal("You must specify the output path.")
+		err = &OptionError{Option: "o", Value: outputDir, Reason: "you must specify the output path"}
+		return
 	}
 
-	if filepath.IsAbs(inputPath) {
-		inputAbs = inputPath
-	} else {
-		cwd, err := os.Getwd()
-		if err != nil {
-			logger.Fatal(err)
-			return
-		}
-		inputAbs = filepath.Join(cwd, inputPath)
+	if inputAbs, err = absPath(inputPath); err != nil {
+		return
 	}
+	outputAbs, err = absPath(outputDir)
+	return
+}
+
+func ValidateImportPaths(importPaths []string) (res []string, err error) {
+	return validateImportPaths(nil, importPaths)
+}
 
-	if filepath.IsAbs(outputDir) {
-		outputAbs = outputDir
-	} else {
-		cwd, err := os.Getwd()
-		if err != nil {
-			logger.Fatal(err)
+// Validate import paths in fsys, they are relative to its root, or current working directory if fsys is nil.
+func validateImportPaths(fsys fs.FS, importPaths []string) (res []string, err error) {
+	for _, p := range importPaths {
+		if fsys != nil {
+			p = fsAbsPath(p)
+		} else if p, err = absPath(p); err != nil {
+			return
+		}
+		stat, statErr := statFile(fsys, p)
+		if statErr != nil || !stat.IsDir() {
+			err = &OptionError{Option: "I", Value: p, Reason: "it must be an existing directory"}
 			return
 		}
-		outputAbs = filepath.Join(cwd, outputDir)
+		res = append(res, p)
 	}
 	return
 }
 
-func ValidateIndentSpace(indentSpace string) {
-	_, err := strconv.Atoi(indentSpace)
-	if err != nil {
-		logger.Fatalf("Invalid indent-space option %v", indentSpace)
+func ValidateImportRoot(importRoot string, outputDir string) (res string, err error) {
+	if importRoot == "" {
+		return
+	}
+	if res, err = absPath(importRoot); err != nil {
+		return
+	}
+	if rel, relErr := filepath.Rel(res, outputDir); relErr != nil || strings.HasPrefix(rel, "..") {
+		err = &OptionError{Option: "import-root", Value: res, Reason: fmt.Sprintf("output dir %v must be inside it", outputDir)}
 	}
+	return
 }
 
-func ValidateSyntax(syntaxStr string) (res int) {
-	var err error
-	if res, err = strconv.Atoi(syntaxStr); err != nil {
-		logger.Fatalf("Invalid syntax option %v", syntaxStr)
+func ValidateIndentSpace(indentSpace string) (err error) {
+	if _, convErr := strconv.Atoi(indentSpace); convErr != nil {
+		err = &OptionError{Option: "indent-space", Value: indentSpace, Reason: "it must be an integer"}
 	}
 	return
 }
 
-func ValidateRecursive(recursiveStr string) (res bool) {
-	var err error
-	var resInt int
-	if resInt, err = strconv.Atoi(recursiveStr); err != nil {
-		logger.Fatalf("Invalid recursive option %v", recursiveStr)
-	} else {
-		if resInt == 1 {
-			res = true
-		} else {
-			res = false
-		}
+func ValidateSyntax(syntaxStr string) (res int, err error) {
+	var convErr error
+	if res, convErr = strconv.Atoi(syntaxStr); convErr != nil {
+		err = &OptionError{Option: "syntax", Value: syntaxStr, Reason: "it must be 2 or 3"}
+	}
+	return
+}
+
+func ValidateCase(option string, strCase string) (err error) {
+	switch strCase {
+	case "camelCase", "snakeCase", "kababCase", "pascalCase", "screamingSnakeCase":
+	default:
+		err = &OptionError{Option: option, Value: strCase, Reason: "available options: camelCase, snakeCase, kababCase, pascalCase, screamingSnakeCase"}
+	}
+	return
+}
+
+func ValidateRecursive(recursiveStr string) (res bool, err error) {
+	resInt, convErr := strconv.Atoi(recursiveStr)
+	if convErr != nil {
+		err = &OptionError{Option: "r", Value: recursiveStr, Reason: "it must be 0 or 1"}
+		return
 	}
+	res = resInt == 1
 	return
 }
+
+// Return absolute path for path relative to current working directory.
+func absPath(path string) (res string, err error) {
+	if filepath.IsAbs(path) {
+		return path, nil
+	}
+	cwd, err := os.Getwd()
+	if err != nil {
+		return "", fmt.Errorf("get working directory: %w", err)
+	}
+	return filepath.Join(cwd, path), nil
+}
+
+// Flag value which can be specified multiple times, e.g. -I a -I b
+type stringsFlag []string
+
+func (f *stringsFlag) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *stringsFlag) Set(value string) error {
+	*f = append(*f, value)
+	return nil
+}
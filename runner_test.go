@@ -0,0 +1,88 @@
+package pbthrift
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Convert files in memory by the config, return content of converted files by slash separated paths relative to
+// OutputDir.
+func pipeFiles(t *testing.T, config RunnerConfig) map[string]string {
+	t.Helper()
+	r, err := NewRunnerWithConfig(config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	files, err := r.PipeAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := map[string]string{}
+	for _, f := range files {
+		rel, err := filepath.Rel(r.Config.OutputDir, f.Path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res[filepath.ToSlash(rel)] = string(f.Content)
+	}
+	return res
+}
+
+func TestConcurrency(t *testing.T) {
+	input := t.TempDir()
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("syntax = \"proto3\";\npackage api.v%d;\n\n", i)
+		if i > 0 {
+			content += fmt.Sprintf("import \"v%d/a.proto\";\n\nmessage A {\n\tapi.v%d.A prev = 1;\n}\n", i-1, i-1)
+		} else {
+			content += "message A {\n\tstring id = 1;\n}\n"
+		}
+		dir := filepath.Join(input, fmt.Sprintf("v%d", i))
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(dir, "a.proto"), []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// converted files and summary of each concurrency, by slash separated paths relative to the output dir
+	run := func(concurrency int) (res map[string]string, summary string) {
+		output := t.TempDir()
+		var buf bytes.Buffer
+		r, err := NewRunnerWithConfig(RunnerConfig{
+			Task:        TASK_FILE_PROTO2THRIFT,
+			InputPath:   input,
+			OutputDir:   output,
+			Recursive:   true,
+			ImportPaths: []string{input},
+			Concurrency: concurrency,
+			Summary:     &buf,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err = r.Run(); err != nil {
+			t.Fatal(err)
+		}
+		return readFiles(t, output), strings.ReplaceAll(buf.String(), output, "OUTPUT")
+	}
+	files, summary := run(1)
+	if len(files) != 20 || summary == "" {
+		t.Errorf("converted files = %d and summary %q, want 20 files with summary", len(files), summary)
+	}
+	for _, concurrency := range []int{2, 8} {
+		got, gotSummary := run(concurrency)
+		if !reflect.DeepEqual(got, files) {
+			t.Errorf("converted files with -j %d differ from -j 1", concurrency)
+		}
+		if gotSummary != summary {
+			t.Errorf("summary with -j %d =\n%s\nwant\n%s", concurrency, gotSummary, summary)
+		}
+	}
+}
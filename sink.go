@@ -0,0 +1,159 @@
+package pbthrift
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Destination for converted files, path is relative to the output dir and slash separated, it's empty for raw content
+// task. Implementations must be safe for concurrent use.
+type Sink interface {
+	WriteFile(path string, content []byte) (err error)
+}
+
+// Callback used as Sink, e.g. to intercept every converted file
+type SinkFunc func(path string, content []byte) (err error)
+
+func (f SinkFunc) WriteFile(path string, content []byte) (err error) {
+	return f(path, content)
+}
+
+// Sink writing files into a directory, parent directories are created when needed. Existing files without generated
+// header are not overwritten unless Force is true, so that hand-written idl is not destroyed by a mistyped output dir.
+type DirSink struct {
+	dir   string
+	Force bool
+}
+
+func NewDirSink(dir string) (res *DirSink) {
+	return &DirSink{dir: dir}
+}
+
+func (s *DirSink) WriteFile(path string, content []byte) (err error) {
+	outputPath := filepath.Join(s.dir, filepath.FromSlash(path))
+	if !s.Force {
+		if current, readErr := os.ReadFile(outputPath); readErr == nil && !isGenerated(current) {
+			return &FileError{Op: "overwrite", Path: outputPath, Err: ErrNotGenerated}
+		}
+	}
+	if err = os.MkdirAll(filepath.Dir(outputPath), 0755); err != nil {
+		return
+	}
+	return os.WriteFile(outputPath, content, 0644)
+}
+
+// Sink writing content of all files to a writer one after another, e.g. os.Stdout
+type WriterSink struct {
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewWriterSink(w io.Writer) (res *WriterSink) {
+	return &WriterSink{w: w}
+}
+
+func NewStdoutSink() (res *WriterSink) {
+	return NewWriterSink(os.Stdout)
+}
+
+func (s *WriterSink) WriteFile(path string, content []byte) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	f := bufio.NewWriter(s.w)
+	defer f.Flush()
+	_, err = f.Write(content)
+	return
+}
+
+// Sink keeping files in memory
+type MemorySink struct {
+	mu    sync.Mutex
+	files map[string][]byte
+}
+
+func NewMemorySink() (res *MemorySink) {
+	return &MemorySink{files: make(map[string][]byte)}
+}
+
+func (s *MemorySink) WriteFile(path string, content []byte) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.files[path] = append([]byte(nil), content...)
+	return
+}
+
+// Return content of the file written, ok is false if it's not written.
+func (s *MemorySink) File(path string) (content []byte, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	content, ok = s.files[path]
+	return
+}
+
+// Return paths of all written files, sorted.
+func (s *MemorySink) Paths() (res []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for path := range s.files {
+		res = append(res, path)
+	}
+	sort.Strings(res)
+	return
+}
+
+// Sink writing files into a tar or zip archive, Close must be called to finish the archive, the underlying writer is
+// not closed.
+type ArchiveSink struct {
+	mu    sync.Mutex
+	tar   *tar.Writer
+	zip   *zip.Writer
+	mtime time.Time
+}
+
+func NewTarSink(w io.Writer) (res *ArchiveSink) {
+	return &ArchiveSink{tar: tar.NewWriter(w), mtime: time.Now()}
+}
+
+func NewZipSink(w io.Writer) (res *ArchiveSink) {
+	return &ArchiveSink{zip: zip.NewWriter(w), mtime: time.Now()}
+}
+
+func (s *ArchiveSink) WriteFile(path string, content []byte) (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.zip != nil {
+		var w io.Writer
+		if w, err = s.zip.CreateHeader(&zip.FileHeader{Name: path, Method: zip.Deflate, Modified: s.mtime}); err != nil {
+			return
+		}
+		_, err = w.Write(content)
+		return
+	}
+	header := &tar.Header{
+		Name:    path,
+		Mode:    0644,
+		Size:    int64(len(content)),
+		ModTime: s.mtime,
+	}
+	if err = s.tar.WriteHeader(header); err != nil {
+		return
+	}
+	_, err = s.tar.Write(content)
+	return
+}
+
+func (s *ArchiveSink) Close() (err error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.zip != nil {
+		return s.zip.Close()
+	}
+	return s.tar.Close()
+}
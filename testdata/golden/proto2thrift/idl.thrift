@@ -0,0 +1,60 @@
+// generated by protobuf-thrift from idl.proto; DO NOT EDIT
+
+namespace * test.test.test
+
+// comment enum
+enum status {
+	statusUnknown = 0
+	statusUnreviewed = 1 // comment enum
+	statusOnline = 2
+	statusRejected = 3
+	statusOffline = 4
+}
+/**
+ * comments
+ *comments 
+ */
+struct config {
+	1: i64 id
+	2: i32 tag
+	3: list<i32> typeList
+	4: bool boolean // comment
+	5: status status /* 1231231     asdasd  */
+	6: map<i64, string> failMap /* asdasdasdasdasdsad  */
+	7: double fl
+	8: double db
+	9: binary bs
+	10: timeRange nested
+	11: list<timeRange> nestedTypeList
+	12: map<string, timeRange> nestedTypeMap
+}
+struct timeRange {
+	1: i64 start
+	2: i64 end
+}
+struct reqOfTestGetApi {
+	1: i64 a
+	2: string b
+}
+struct respOfTestGetApi {
+	1: i32 code
+	2: string message
+}
+struct reqOfTestPostApi {
+	1: i64 a
+	2: string b
+}
+struct respOfTestPostApi {
+	1: i32 code
+	2: string message
+}
+// service comment aaaa
+
+service aPIs {
+	// rpc comment aaaa
+	respOfTestGetApi testGetApi (1: reqOfTestGetApi req)
+	/**
+	 * rpc comment bbbb 
+	 */
+	respOfTestPostApi testPostApi (1: reqOfTestPostApi req)
+}
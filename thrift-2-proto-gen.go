@@ -1,13 +1,12 @@
 package pbthrift
 
 import (
-	"bufio"
 	"bytes"
 	"fmt"
-	"os"
+	"io/fs"
 	"path/filepath"
-	"strconv"
 	"strings"
+	"unicode"
 
 	"github.com/YYCoder/protobuf-thrift/utils"
 	"github.com/YYCoder/protobuf-thrift/utils/logger"
@@ -17,498 +16,545 @@ import (
 type protoGenerator struct {
 	conf           *ProtoGeneratorConfig
 	def            *thrifter.Thrift
-	file           *os.File
+	file           fs.File
 	protoContent   bytes.Buffer
-	currentToken   *thrifter.Token
-	packageDeclare string // used to detect whether has duplicate package
+	declared       map[string]bool           // thrift identifiers of structs and enums declared in current file
+	nestedTypes    map[string]*nestedType    // thrift identifier => nested type, only collected when nestedTypes option is on
+	scope          []string                  // name path of the message being generated, used to shorten nested type references
+	includes       map[string]*thriftInclude // include alias => included file, used to qualify types from it
+	commonIncluded map[string]bool           // absolute path of common files of include cycles which have been imported
+	inCommon       bool                      // whether writing declarations moved to the common file of include cycle
 }
 
-type ProtoGeneratorConfig struct {
-	taskType   int
-	filePath   string // absolute path for current file
-	fileName   string // output file name, including extension
-	rawContent string
-	outputDir  string // absolute path for output dir
+// Declarations of an included thrift file, used to resolve type references across files
+type thriftInclude struct {
+	pkg       string          // proto package of the converted file, which is its thrift namespace
+	generator *protoGenerator // used to resolve nested types declared in it
+	cycle     *cycleInfo      // not nil if its types are moved to the common file of include cycle
+}
 
-	useSpaceIndent bool
-	indentSpace    string
-	fieldCase      string
-	nameCase       string
+// Thrift struct or enum which will be regrouped into its enclosing message
+type nestedType struct {
+	parent string // thrift identifier of the enclosing struct
+	name   string // name inside the enclosing message
+}
+
+type ProtoGeneratorConfig struct {
+	TaskType   int
+	FS         fs.FS  // input file system, OS file system is used if it's nil
+	FilePath   string // absolute path for current file
+	FileName   string // output file name, including extension
+	RawContent string
+	OutputDir  string // absolute path for output dir
+
+	OutputRootDir string     // absolute path for root output dir, output paths of files found in importPaths are relative to it
+	ImportRoot    string     // absolute path for root dir of the output idl tree, generated import paths are relative to it
+	ImportPaths   []string   // absolute paths for directories to search included files in
+	cycle         *cycleInfo // not nil if current file is in an include cycle, its types will be moved to the common file
+	// return the broken include cycle containing the file, whose types are moved to the common file, nil if there is not
+	cycleOf func(absPath string) *cycleInfo
+	// options of other files by RunnerConfig.Overrides, e.g. name case of imported files, nil if there is no override
+	fileOptions func(absPath string) fileOptions
+
+	UseSpaceIndent bool
+	IndentSpace    string
+	FieldCase      string
+	NameCase       string
+	NestedTypes    bool // regroup flattened thrift types into nested declarations
 
 	// pb config
-	syntax int // 2 or 3
+	Syntax int // 2 or 3
 }
 
 func NewProtoGenerator(conf *ProtoGeneratorConfig) (res SubGenerator, err error) {
 	var parser *thrifter.Parser
-	var file *os.File
+	var file fs.File
 	var definition *thrifter.Thrift
-	if conf.taskType == TASK_FILE_THRIFT2PROTO {
-		file, err = os.Open(conf.filePath)
+	if conf.TaskType == TASK_FILE_THRIFT2PROTO {
+		file, err = openFile(conf.FS, conf.FilePath)
 		if err != nil {
 			return nil, err
 		}
 		defer file.Close()
 		parser = thrifter.NewParser(file, false)
-		definition, err = parser.Parse(file.Name())
+		definition, err = parser.Parse(conf.FilePath)
 
-	} else if conf.taskType == TASK_CONTENT_THRIFT2PROTO {
-		rd := strings.NewReader(conf.rawContent)
+	} else if conf.TaskType == TASK_CONTENT_THRIFT2PROTO {
+		rd := strings.NewReader(conf.RawContent)
 		parser = thrifter.NewParser(rd, false)
 		definition, err = parser.Parse("INPUT")
 	}
 
 	if err != nil {
-		return
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdl, err)
 	}
 
 	res = &protoGenerator{
-		conf: conf,
-		def:  definition,
-		file: file,
+		conf:        conf,
+		def:         definition,
+		file:        file,
+		declared:    make(map[string]bool),
+		nestedTypes: make(map[string]*nestedType),
+		includes:    make(map[string]*thriftInclude),
+
+		commonIncluded: make(map[string]bool),
 	}
 	return
 }
 
 func (g *protoGenerator) FilePath() (res string) {
-	if g.conf.taskType == TASK_CONTENT_THRIFT2PROTO {
+	if g.conf.TaskType == TASK_CONTENT_THRIFT2PROTO {
 		res = ""
 	} else {
-		res = g.conf.filePath
+		res = g.conf.FilePath
 	}
 	return
 }
 
-func (g *protoGenerator) findNodeByStartToken(startToken *thrifter.Token, nodeType string) (res thrifter.Node) {
-	for _, node := range g.def.Nodes {
-		if node.NodeType() != nodeType {
-			continue
-		}
-		switch node.NodeType() {
-		case "Namespace":
-			n := node.(*thrifter.Namespace)
-			if n.StartToken == startToken {
-				return n
-			}
-		case "Enum":
-			n := node.(*thrifter.Enum)
-			if n.StartToken == startToken {
-				return n
-			}
-		case "Struct":
-			n := node.(*thrifter.Struct)
-			if n.StartToken == startToken {
-				return n
-			}
-		case "Service":
-			n := node.(*thrifter.Service)
-			if n.StartToken == startToken {
-				return n
-			}
-		case "Include":
-			n := node.(*thrifter.Include)
-			if n.StartToken == startToken {
-				return n
-			}
+// Lower thrift ast into schema, convert each declaration to protobuf declaration, then print it. Return absolute file
+// paths included by current file.
+func (g *protoGenerator) Parse() (newFiles []FileInfo, err error) {
+	schema := LowerThrift(g.def)
+	stripGeneratedHeader(schema)
+	schema.Syntax = g.conf.Syntax
+	for _, e := range schema.Elements {
+		switch e := e.(type) {
+		case *Message:
+			g.declared[e.Name] = true
+		case *Enum:
+			g.declared[e.Name] = true
 		}
 	}
-	return
-}
-
-// iterate over token linked-list until specified token.
-func (g *protoGenerator) consumeUntilLiteral(lit string) {
-	for g.currentToken.Raw != lit && g.currentToken != nil {
-		g.currentToken = g.currentToken.Next
+	if g.conf.NestedTypes {
+		g.collectNestedTypes(schema.Elements)
+		schema.Elements = g.regroupNestedTypes(schema.Elements)
 	}
-}
-
-// parse thrift ast, return absolute file paths included by current file
-func (g *protoGenerator) Parse() (newFiles []FileInfo, err error) {
-	g.handleSyntax()
-
-	g.currentToken = g.def.StartToken
-
-	for g.currentToken != nil {
-		switch g.currentToken.Type {
-		case thrifter.T_COMMENT:
-			g.handleComment(g.currentToken)
-
-		case thrifter.T_LINEBREAK, thrifter.T_RETURN:
-			g.protoContent.WriteString(g.currentToken.Raw)
-			g.currentToken = g.currentToken.Next
-
-		case thrifter.T_NAMESPACE:
-			n := g.findNodeByStartToken(g.currentToken, "Namespace")
-			node := n.(*thrifter.Namespace)
-			g.handleNamespace(node)
-			g.currentToken = node.EndToken
-
-		case thrifter.T_ENUM:
-			n := g.findNodeByStartToken(g.currentToken, "Enum")
-			node := n.(*thrifter.Enum)
-			g.handleEnum(node)
-			g.currentToken = node.EndToken
-
-		case thrifter.T_STRUCT:
-			n := g.findNodeByStartToken(g.currentToken, "Struct")
-			node := n.(*thrifter.Struct)
-			g.handleStruct(node)
-			g.currentToken = node.EndToken
-
-		case thrifter.T_SERVICE:
-			n := g.findNodeByStartToken(g.currentToken, "Service")
-			node := n.(*thrifter.Service)
-			g.handleService(node)
-			g.currentToken = node.EndToken
-
-		case thrifter.T_INCLUDE, thrifter.T_CPP_INCLUDE:
-			n := g.findNodeByStartToken(g.currentToken, "Include")
-			node := n.(*thrifter.Include)
-			newFiles = append(newFiles, g.handleIncludes(node.FilePath))
-			g.currentToken = node.EndToken
 
-		default:
-			// other token will ignore
-			g.currentToken = g.currentToken.Next
+	elements := []Element{}
+	for _, e := range schema.Elements {
+		switch e := e.(type) {
+		case *Package:
+			g.handleNamespace(e)
+			elements = append(elements, e)
+		case *Import:
+			newFile, keep := g.handleIncludes(e)
+			newFiles = append(newFiles, newFile)
+			if keep {
+				elements = append(elements, e)
+			} else {
+				elements = append(elements, detachComments(e.Trivia)...)
+			}
+		case *Message:
+			elements = append(elements, g.handleDeclaration(e, func() { g.handleStruct(e) })...)
+		case *Enum:
+			elements = append(elements, g.handleDeclaration(e, func() { g.handleEnum(e) })...)
+		case *Service:
+			g.handleService(e)
+			elements = append(elements, e)
+		case *Comment:
+			elements = append(elements, e)
 		}
-
 	}
-
+	schema.Elements = elements
+	g.protoContent.Write(PrintProto(schema, indentUnit(g.conf.UseSpaceIndent, g.conf.IndentSpace)))
 	return
 }
 
-func (g *protoGenerator) handleSyntax() {
-	g.protoContent.WriteString(fmt.Sprintf("syntax = \"proto%d\";\n", g.conf.syntax))
-	return
-}
-
-func (g *protoGenerator) handleNamespace(node *thrifter.Namespace) {
-	if g.packageDeclare == "" {
-		g.protoContent.WriteString(fmt.Sprintf("package %s;", node.Value))
-		g.packageDeclare = node.Value
+// Since protobuf file has only one package, only the first namespace is lowered as package.
+func (g *protoGenerator) handleNamespace(p *Package) {
+	if g.conf.cycle != nil {
+		g.conf.cycle.setPackage(g.conf.FilePath, p.Name)
 	}
 	return
 }
 
-func (g *protoGenerator) handleIncludes(path string) (newFile FileInfo) {
+// Resolve included file and convert include declaration to import declaration, return false if it should be dropped.
+func (g *protoGenerator) handleIncludes(i *Import) (newFile FileInfo, keep bool) {
+	path := i.Path
 	if filepath.IsAbs(path) {
-		relPath, err := filepath.Rel(g.conf.filePath, path)
+		relPath, err := filepath.Rel(g.conf.FilePath, path)
 		if err != nil {
-			logger.Errorf("filepath.Rel %v %v, err %v", g.conf.filePath, path, err)
+			logger.Errorf("filepath.Rel %v %v, err %v", g.conf.FilePath, path, err)
 			return
 		}
 		newFile = FileInfo{
 			absPath:    path,
-			outputPath: filepath.Join(g.conf.outputDir, strings.ReplaceAll(relPath, ".thrift", ".proto")),
+			outputPath: filepath.Join(g.conf.OutputDir, strings.ReplaceAll(relPath, ".thrift", ".proto")),
+			includedBy: g.conf.FilePath,
+		}
+	} else if absPath, _, found := findInImportPaths(g.conf.FS, g.conf.ImportPaths, path); found && !fileExists(g.conf.FS, filepath.Join(filepath.Dir(g.conf.FilePath), path)) {
+		// same as thrift compiler, included path is searched in current file's directory first, then the include directories
+		newFile = FileInfo{
+			absPath:    absPath,
+			outputPath: filepath.Join(g.conf.OutputRootDir, strings.ReplaceAll(path, ".thrift", ".proto")),
+			includedBy: g.conf.FilePath,
 		}
 	} else {
 		newFile = FileInfo{
-			absPath:    filepath.Join(filepath.Dir(g.conf.filePath), path),
-			outputPath: filepath.Join(g.conf.outputDir, strings.ReplaceAll(path, ".thrift", ".proto")),
+			absPath:    filepath.Join(filepath.Dir(g.conf.FilePath), path),
+			outputPath: filepath.Join(g.conf.OutputDir, strings.ReplaceAll(path, ".thrift", ".proto")),
+			includedBy: g.conf.FilePath,
 		}
 	}
 
-	filePath := strings.ReplaceAll(path, ".thrift", ".proto")
 	// ! NOTE: proto import paths are relative to protoc command's working directory or using
 	// ! NOTE: -I/--proto_path specified path, and can not include relative paths prefix, such as `./XXX.proto`.
-	// ! NOTE: so, user have to manually check the generated path is correct.
+	// ! NOTE: so, if import root is not specified, user have to manually check the generated path is correct.
 	// ! NOTE: https://developers.google.com/protocol-buffers/docs/proto#importing_definitions
-	g.protoContent.WriteString(fmt.Sprintf(`import "%s";`, filePath))
-	return
-}
-
-// will ignore service/rpc options, since we already change to another language idl, the meaning for options are
-// totally different
-func (g *protoGenerator) handleService(s *thrifter.Service) {
-	for g.currentToken != s.EndToken {
-		switch g.currentToken.Type {
-		case thrifter.T_COMMENT:
-			g.writeIndent()
-			g.handleComment(g.currentToken)
-
-		case thrifter.T_LINEBREAK, thrifter.T_RETURN:
-			g.protoContent.WriteString(g.currentToken.Raw)
-			g.currentToken = g.currentToken.Next
-
-		case thrifter.T_SERVICE:
-			g.consumeUntilLiteral("{")
-			// consume { token
-			g.currentToken = g.currentToken.Next
-			g.protoContent.WriteString(fmt.Sprintf("service %s {", utils.CaseConvert(g.conf.nameCase, s.Ident)))
-
-		default:
-			hash := thrifter.GenTokenHash(g.currentToken)
-			// find out current token is the start token of a function node
-			function, isFunctionStartToken := s.ElemsMap[hash]
-			if !isFunctionStartToken {
-				g.currentToken = g.currentToken.Next
-				continue
-			}
-
-			name := utils.CaseConvert(g.conf.nameCase, function.Ident)
-			// if there are multiple arguments, will only pick first one, because protobuf rpc only support one argument
-			var reqName, resName string
-			if len(function.Args) > 0 {
-				// if the thrift function argument is a base type, e.g. i32/i64/bool/string, will be ignored
-				reqName = utils.CaseConvert(g.conf.nameCase, function.Args[0].FieldType.Ident)
+	// ! NOTE: relative prefix like `./` is removed, since protoc does not allow it
+	fallback := filepath.ToSlash(filepath.Clean(strings.ReplaceAll(path, ".thrift", ".proto")))
+	filePath := importPathFromRoot(g.conf.ImportRoot, newFile.outputPath, fallback)
+
+	cycle, moved := g.conf.cycle, g.movedTo(newFile.absPath)
+	switch {
+	case moved != nil:
+		// types of files in an include cycle are moved to the common file, import it instead. Members import it
+		// publicly, so that files importing them outside of current run still see the moved types
+		if !g.commonIncluded[moved.common.absPath] {
+			g.commonIncluded[moved.common.absPath] = true
+			i.Path = includePathFor(g.conf.ImportRoot, filepath.Join(g.conf.OutputDir, g.conf.FileName), moved.common.outputPath)
+			keep = true
+			if cycle == moved {
+				i.Kind = "public"
 			}
-			// if thrift function return type is void, leave the rpc return field empty
-			if !function.Void && function.FunctionType != nil {
-				resName = utils.CaseConvert(g.conf.nameCase, function.FunctionType.Ident)
-			}
-			// oneway/throws/options will be ignored.
-			g.writeIndent()
-			g.protoContent.WriteString(fmt.Sprintf("rpc %s(%s) returns (%s) {}", name, reqName, resName))
-
-			// move to end token of the function node
-			g.currentToken = function.EndToken
 		}
+		if cycle != nil && cycle != moved {
+			cycle.addInclude(moved.common)
+		}
+	case cycle != nil:
+		cycle.addInclude(newFile)
+		i.Path, keep = filePath, true
+	default:
+		i.Path, keep = filePath, true
 	}
 
-	g.protoContent.WriteString("}\n")
-	g.currentToken = s.EndToken
-
+	if g.conf.TaskType == TASK_FILE_THRIFT2PROTO {
+		// same as thrift, types from included file are referred with file name as prefix
+		alias := strings.TrimSuffix(filepath.Base(path), ".thrift")
+		g.includes[alias] = g.loadInclude(newFile.absPath)
+		g.includes[alias].cycle = moved
+	}
 	return
 }
 
-func (g *protoGenerator) handleComment(tok *thrifter.Token) {
-	if strings.HasPrefix(g.currentToken.Raw, "#") {
-		content := fmt.Sprintf("//%s", strings.Replace(g.currentToken.Raw, "#", "", 1))
-		g.protoContent.WriteString(content)
-		g.currentToken = g.currentToken.Next
-		return
+// Return the include cycle whose common file holds types of the file, nil if they are not moved.
+func (g *protoGenerator) movedTo(absPath string) *cycleInfo {
+	if g.conf.cycle != nil && g.conf.cycle.contains(absPath) {
+		return g.conf.cycle
+	}
+	if g.conf.cycleOf != nil {
+		return g.conf.cycleOf(absPath)
 	}
-	g.protoContent.WriteString(g.currentToken.Raw)
-	g.currentToken = g.currentToken.Next
+	return nil
 }
 
-func (g *protoGenerator) handleEnum(e *thrifter.Enum) {
-	hasTraverseFirstElement := false
+// Convert enum or message declaration by handle, if current file is in an include cycle, it's moved to the common file.
+func (g *protoGenerator) handleDeclaration(e Element, handle func()) (res []Element) {
+	if g.conf.cycle == nil {
+		handle()
+		return []Element{e}
+	}
+	g.inCommon = true
+	handle()
+	g.conf.cycle.elements = append(g.conf.cycle.elements, e)
+	g.inCommon = false
+	return
+}
 
-	for g.currentToken != e.EndToken {
-		switch g.currentToken.Type {
-		case thrifter.T_COMMENT:
-			g.writeIndent()
-			g.handleComment(g.currentToken)
+// Return name of type moved to the common file of include cycle, qualified with its package outside of the common file.
+func (g *protoGenerator) commonTypeName(cycle *cycleInfo, path []string) string {
+	if !(g.inCommon && cycle == g.conf.cycle) && cycle.pkg != "" {
+		path = append([]string{cycle.pkg}, path...)
+	}
+	return strings.Join(path, ".")
+}
 
-		case thrifter.T_LINEBREAK, thrifter.T_RETURN:
-			g.protoContent.WriteString(g.currentToken.Raw)
-			g.currentToken = g.currentToken.Next
+// Load declarations of included file, including its namespace and nested types.
+func (g *protoGenerator) loadInclude(absPath string) (res *thriftInclude) {
+	res = &thriftInclude{}
+	file, err := openFile(g.conf.FS, absPath)
+	if err != nil {
+		logger.Warnf("Could not open included file %v, types from it will not be qualified", absPath)
+		return
+	}
+	defer file.Close()
+	definition, err := thrifter.NewParser(file, false).Parse(absPath)
+	if err != nil {
+		logger.Warnf("Could not parse included file %v, types from it will not be qualified, %v", absPath, err)
+		return
+	}
+	schema := LowerThrift(definition)
+	for _, e := range schema.Elements {
+		if p, ok := e.(*Package); ok {
+			res.pkg = p.Name
+		}
+	}
+	conf := g.conf
+	if g.conf.fileOptions != nil {
+		// names in included file are converted by its own options
+		opts := g.conf.fileOptions(absPath)
+		copied := *g.conf
+		copied.NameCase, copied.NestedTypes = opts.nameCase, opts.nestedTypes
+		conf = &copied
+	}
+	res.generator = &protoGenerator{
+		conf:        conf,
+		def:         definition,
+		nestedTypes: make(map[string]*nestedType),
+	}
+	if conf.NestedTypes {
+		res.generator.collectNestedTypes(schema.Elements)
+	}
+	return
+}
 
-		case thrifter.T_ENUM:
-			g.consumeUntilLiteral("{")
-			// consume { token
-			g.currentToken = g.currentToken.Next
-			g.protoContent.WriteString(fmt.Sprintf("enum %s {", utils.CaseConvert(g.conf.nameCase, e.Ident)))
+// will ignore service/rpc options, since we already change to another language idl, the meaning for options are
+// totally different
+func (g *protoGenerator) handleService(s *Service) {
+	s.Name = utils.CaseConvert(g.conf.NameCase, s.Name)
+	for _, m := range s.Methods {
+		m.Name = utils.CaseConvert(g.conf.NameCase, m.Name)
+		// if the thrift function argument or return type is not a struct, e.g. i32/i64/bool/string, will be ignored
+		m.Request = g.resolveRPCType(m.Request)
+		m.Response = g.resolveRPCType(m.Response)
+	}
+}
 
-		default:
-			hash := thrifter.GenTokenHash(g.currentToken)
-			// find out current token is the start token of a enum element node
-			ele, isElemStartToken := e.ElemsMap[hash]
-			if !isElemStartToken {
-				g.currentToken = g.currentToken.Next
-				continue
-			}
+func (g *protoGenerator) resolveRPCType(t *Type) *Type {
+	if t == nil || t.Kind != TypeNamed {
+		return nil
+	}
+	return g.resolveType(t)
+}
 
-			// if g.currentToken is identical with ele.EndToken, means that the grammar is wrong
-			if g.currentToken == ele.EndToken {
-				logger.Errorf(fmt.Sprintf("invalid token for enum %s element %s, pass", e.Ident, g.currentToken.Raw))
-				g.currentToken = g.currentToken.Next
-				continue
-			}
+func (g *protoGenerator) handleEnum(e *Enum) {
+	// proto 3 enum first element must be zero, add a default element to it
+	if g.conf.Syntax == 3 && len(e.Values) > 0 && e.Values[0].Value > 0 {
+		zero := &EnumValue{Name: fmt.Sprintf("%s_Unknown", e.Name)}
+		e.Values = append([]*EnumValue{zero}, e.Values...)
+	}
+	for _, v := range e.Values {
+		v.Name = utils.CaseConvert(g.conf.FieldCase, v.Name)
+	}
+	e.Name = g.declarationName(e.Name)
+	e.Options = nil
+}
 
-			if !hasTraverseFirstElement {
-				hasTraverseFirstElement = true
-				// proto 3 enum first element must be zero, add a default element to it
-				if ele.ID > 0 && g.conf.syntax == 3 {
-					g.writeIndent()
-					name := utils.CaseConvert(g.conf.fieldCase, fmt.Sprintf("%s_Unknown", e.Ident))
-					g.protoContent.WriteString(fmt.Sprintf("%s = 0;\n", name))
-				}
-			}
-			name := utils.CaseConvert(g.conf.fieldCase, ele.Ident)
-			g.writeIndent()
-			g.protoContent.WriteString(fmt.Sprintf("%s = %d;", name, ele.ID))
+func (g *protoGenerator) handleStruct(m *Message) {
+	scope := g.scope
+	g.scope = g.nestedTypePath(m.Name)
+	defer func() { g.scope = scope }()
 
-			// move to end token of the enum element node
-			g.currentToken = ele.EndToken
+	for _, f := range m.Fields {
+		f.Name = utils.CaseConvert(g.conf.FieldCase, f.Name)
+		f.Type = g.resolveType(f.Type)
+	}
+	for _, e := range m.Nested {
+		switch e := e.(type) {
+		case *Message:
+			g.handleStruct(e)
+		case *Enum:
+			g.handleEnum(e)
 		}
 	}
-
-	g.protoContent.WriteString("}")
-	g.currentToken = e.EndToken
-
-	return
+	m.Name = g.declarationName(m.Name)
+	m.Options = nil
 }
 
-func (g *protoGenerator) handleStruct(s *thrifter.Struct) {
-	for g.currentToken != s.EndToken {
-		switch g.currentToken.Type {
-		case thrifter.T_COMMENT:
-			g.writeIndent()
-			g.handleComment(g.currentToken)
+// Collect structs and enums which should be nested into another message, either annotated by proto2thrift with
+// pbthrift.nested, or named with the OuterInner convention where Outer is another struct declared in current file.
+// The convention is only applied to files without any annotation, since proto2thrift annotates every nested type it
+// flattens, so that unannotated types in its outputs are kept as top level declarations, e.g. UserRequest beside User.
+func (g *protoGenerator) collectNestedTypes(elements []Element) {
+	structs := map[string]bool{}
+	annotated := false
+	for _, e := range elements {
+		switch e := e.(type) {
+		case *Message:
+			structs[e.Name] = true
+			annotated = annotated || hasOption(e.Options, nestedAnnotation)
+		case *Enum:
+			annotated = annotated || hasOption(e.Options, nestedAnnotation)
+		}
+	}
 
-		case thrifter.T_LINEBREAK, thrifter.T_RETURN:
-			g.protoContent.WriteString(g.currentToken.Raw)
-			g.currentToken = g.currentToken.Next
+	for _, e := range elements {
+		var ident string
+		var options []*Option
+		switch e := e.(type) {
+		case *Message:
+			ident, options = e.Name, e.Options
+		case *Enum:
+			ident, options = e.Name, e.Options
+		default:
+			continue
+		}
 
-		case thrifter.T_STRUCT:
-			g.consumeUntilLiteral("{")
-			// consume { token
-			g.currentToken = g.currentToken.Next
-			g.protoContent.WriteString(fmt.Sprintf("message %s {", utils.CaseConvert(g.conf.nameCase, s.Ident)))
+		if nested := g.findNestedAnnotation(options); nested != nil {
+			if !structs[nested.parent] {
+				logger.Warnf("enclosing struct %s of %s not found, ignore annotation %s", nested.parent, ident, nestedAnnotation)
+			} else {
+				g.nestedTypes[ident] = nested
+			}
+			continue
+		}
 
-		default:
-			hash := thrifter.GenTokenHash(g.currentToken)
-			// find out current token is the start token of a struct element node
-			ele, isElemStartToken := s.ElemsMap[hash]
-			if !isElemStartToken {
-				g.currentToken = g.currentToken.Next
+		if annotated {
+			continue
+		}
+		// pick the longest struct name as the enclosing struct, e.g. for OuterInnerDeep, OuterInner is preferred to Outer
+		parent := ""
+		for s := range structs {
+			if len(s) <= len(parent) || len(s) >= len(ident) || !strings.HasPrefix(ident, s) {
 				continue
 			}
+			if next := ident[len(s)]; next == '_' || unicode.IsUpper(rune(next)) {
+				parent = s
+			}
+		}
+		if parent != "" {
+			g.nestedTypes[ident] = &nestedType{
+				parent: parent,
+				name:   strings.TrimLeft(ident[len(parent):], "_"),
+			}
+		}
+	}
 
-			name := utils.CaseConvert(g.conf.fieldCase, ele.Ident)
-
-			switch ele.FieldType.Type {
-			// set would be list
-			case thrifter.FIELD_TYPE_LIST:
-				// TODO: support nested list/set/map
-				typeNameOrIdent := ""
-				if ele.FieldType.List.Elem.Type == thrifter.FIELD_TYPE_BASE {
-					typeNameOrIdent = ele.FieldType.List.Elem.BaseType
-				} else {
-					typeNameOrIdent = ele.FieldType.List.Elem.Ident
-				}
-				fieldType, _ := g.typeConverter(typeNameOrIdent)
-
-				g.writeIndent()
-				g.protoContent.WriteString(fmt.Sprintf("repeated %s %s = %d;", fieldType, name, ele.ID))
-			case thrifter.FIELD_TYPE_SET:
-				typeNameOrIdent := ""
-				if ele.FieldType.Set.Elem.Type == thrifter.FIELD_TYPE_BASE {
-					typeNameOrIdent = ele.FieldType.Set.Elem.BaseType
-				} else {
-					typeNameOrIdent = ele.FieldType.Set.Elem.Ident
-				}
-				fieldType, _ := g.typeConverter(typeNameOrIdent)
-
-				g.writeIndent()
-				g.protoContent.WriteString(fmt.Sprintf("repeated %s %s = %d;", fieldType, name, ele.ID))
-
-			case thrifter.FIELD_TYPE_MAP:
-				optional := g.conf.syntax == 2 && ele.Requiredness == "optional"
-				fieldType, keyType := "", ""
-				// TODO: support nested types for map value
-				if ele.FieldType.Map.Value.Type == thrifter.FIELD_TYPE_BASE {
-					fieldType, _ = g.typeConverter(ele.FieldType.Map.Value.BaseType)
-				} else {
-					fieldType, _ = g.typeConverter(ele.FieldType.Map.Value.Ident)
-				}
-				if ele.FieldType.Map.Key.Type == thrifter.FIELD_TYPE_BASE {
-					keyType, _ = g.typeConverter(ele.FieldType.Map.Key.BaseType)
-				} else {
-					keyType, _ = g.typeConverter(ele.FieldType.Map.Key.Ident)
-				}
-				g.writeIndent()
-				if optional {
-					g.protoContent.WriteString("optional ")
-				}
-				g.protoContent.WriteString(fmt.Sprintf("map<%s, %s> %s = %d;", keyType, fieldType, name, ele.ID))
-
-			default:
-				optional := g.conf.syntax == 2 && ele.Requiredness == "optional"
-				typeNameOrIdent := ""
-				if ele.FieldType.Type == thrifter.FIELD_TYPE_BASE {
-					typeNameOrIdent = ele.FieldType.BaseType
-				} else {
-					typeNameOrIdent = ele.FieldType.Ident
-				}
-				fieldType, _ := g.typeConverter(typeNameOrIdent)
-
-				g.writeIndent()
-				if optional {
-					g.protoContent.WriteString("optional ")
-				}
-
-				g.protoContent.WriteString(fmt.Sprintf("%s %s = %d;", fieldType, name, ele.ID))
+	// annotations might be written by hand, drop the ones forming a cycle
+	for ident := range g.nestedTypes {
+		visited := map[string]bool{ident: true}
+		for n := g.nestedTypes[ident]; n != nil; n = g.nestedTypes[n.parent] {
+			if visited[n.parent] {
+				logger.Warnf("cyclic nested types found for %s, keep it as top level declaration", ident)
+				delete(g.nestedTypes, ident)
+				break
 			}
+			visited[n.parent] = true
+		}
+	}
+}
 
-			// move to end token of the enum element node
-			g.currentToken = ele.EndToken
+func hasOption(options []*Option, name string) bool {
+	for _, opt := range options {
+		if opt.Name == name {
+			return true
 		}
 	}
+	return false
+}
 
-	g.protoContent.WriteString("}")
-	g.currentToken = s.EndToken
+func (g *protoGenerator) findNestedAnnotation(options []*Option) (res *nestedType) {
+	for _, opt := range options {
+		if opt.Name != nestedAnnotation {
+			continue
+		}
+		value := strings.Trim(opt.Value, `"'`)
+		idx := strings.LastIndex(value, ".")
+		if idx <= 0 || idx == len(value)-1 {
+			logger.Warnf("invalid %s annotation value %s", nestedAnnotation, opt.Value)
+			return
+		}
+		return &nestedType{
+			parent: value[:idx],
+			name:   value[idx+1:],
+		}
+	}
 	return
 }
 
-func (g *protoGenerator) typeConverter(t string) (res string, err error) {
-	res, err = g.basicTypeConverter(t)
-	if err != nil {
-		// if t is not a basic type, then we should convert its case, same as name
-		res = utils.CaseConvert(g.conf.nameCase, t)
-		return res, nil
+// Move nested structs and enums into their enclosing messages, in the order they are declared.
+func (g *protoGenerator) regroupNestedTypes(elements []Element) (res []Element) {
+	messages := map[string]*Message{}
+	for _, e := range elements {
+		if m, ok := e.(*Message); ok {
+			messages[m.Name] = m
+		}
+	}
+	for _, e := range elements {
+		var ident string
+		switch e := e.(type) {
+		case *Message:
+			ident = e.Name
+		case *Enum:
+			ident = e.Name
+		}
+		if nested, ok := g.nestedTypes[ident]; ok {
+			parent := messages[nested.parent]
+			parent.Nested = append(parent.Nested, e)
+			continue
+		}
+		res = append(res, e)
 	}
 	return
 }
 
-func (g *protoGenerator) basicTypeConverter(t string) (res string, err error) {
-	switch t {
-	case "string":
-		res = "string"
-	case "i64":
-		res = "int64"
-	case "i32":
-		res = "int32"
-	case "double":
-		res = "double"
-	case "bool":
-		res = "bool"
-	// case "byte":
-	// 	res = "bytes"
-	default:
-		err = fmt.Errorf("Invalid basic type %s", t)
+// Return the name for message or enum declaration, nested types use the name inside their enclosing message.
+func (g *protoGenerator) declarationName(ident string) string {
+	if nested, ok := g.nestedTypes[ident]; ok {
+		return utils.CaseConvert(g.conf.NameCase, nested.name)
 	}
-	return
+	return utils.CaseConvert(g.conf.NameCase, ident)
 }
 
-// write thrift code from thriftAST to output
-func (g *protoGenerator) Sink() (err error) {
-	if g.conf.outputDir != "" {
-		var file *os.File
-		err = os.MkdirAll(g.conf.outputDir, 0755)
-		if err != nil {
-			logger.Errorf("Error occurred when MkdirAll %v", g.conf.outputDir)
+// Return full name path of the type, e.g. [Outer Inner] for nested type OuterInner, names are case converted.
+func (g *protoGenerator) nestedTypePath(ident string) (res []string) {
+	for {
+		res = append([]string{g.declarationName(ident)}, res...)
+		nested, ok := g.nestedTypes[ident]
+		if !ok {
 			return
 		}
-		outputPath := filepath.Join(g.conf.outputDir, g.conf.fileName)
-		file, err = os.Create(outputPath)
-		if err != nil {
-			logger.Errorf("os.Create file %v error %v", outputPath, err)
-			return err
-		}
-		defer file.Close()
-		_, err = file.WriteString(g.protoContent.String())
-	} else {
-		f := bufio.NewWriter(os.Stdout)
-		defer f.Flush()
-		_, err = f.Write(g.protoContent.Bytes())
+		ident = nested.parent
 	}
+}
 
-	return
+// Convert field type, type references are converted by identConverter.
+func (g *protoGenerator) resolveType(t *Type) *Type {
+	if t == nil {
+		return nil
+	}
+	switch t.Kind {
+	case TypeNamed:
+		t.Name = g.identConverter(t.Name)
+	case TypeList, TypeSet, TypeMap:
+		if t.Elem != nil && (t.Elem.Kind == TypeList || t.Elem.Kind == TypeSet || t.Elem.Kind == TypeMap) {
+			logger.Warnf("nested container type is not supported by protobuf, only its element type is kept, in %v", g.conf.FilePath)
+		}
+		t.Key = g.resolveType(t.Key)
+		t.Elem = g.resolveType(t.Elem)
+	}
+	return t
 }
 
-func (g *protoGenerator) writeIndent() {
-	if g.conf.useSpaceIndent {
-		spaceCount, _ := strconv.Atoi(g.conf.indentSpace)
-		for i := 0; i < spaceCount; i++ {
-			g.protoContent.WriteString(" ")
+// Convert type identifier reference, nested types are referenced by their path relative to current message.
+func (g *protoGenerator) identConverter(ident string) (res string) {
+	// type from included file, e.g. admin.User, convert include alias to the package of the converted file
+	if idx := strings.Index(ident, "."); idx > 0 {
+		if include, ok := g.includes[ident[:idx]]; ok && include.generator != nil {
+			path := include.generator.nestedTypePath(ident[idx+1:])
+			if include.cycle != nil {
+				return g.commonTypeName(include.cycle, path)
+			}
+			if include.pkg != "" {
+				path = append([]string{include.pkg}, path...)
+			}
+			return strings.Join(path, ".")
 		}
-	} else {
-		g.protoContent.WriteString("	")
 	}
-	return
+	if g.conf.cycle != nil && !g.inCommon && g.declared[ident] {
+		// declarations of current file are moved to the common file
+		return g.commonTypeName(g.conf.cycle, g.nestedTypePath(ident))
+	}
+	if _, ok := g.nestedTypes[ident]; !ok {
+		return utils.CaseConvert(g.conf.NameCase, ident)
+	}
+	path := g.nestedTypePath(ident)
+	// protobuf resolves type names from the innermost scope, so the common outer names can be omitted
+	i := 0
+	for i < len(g.scope) && i < len(path)-1 && g.scope[i] == path[i] {
+		i++
+	}
+	return strings.Join(path[i:], ".")
 }
 
 func (g *protoGenerator) Pipe() (res []byte, err error) {
@@ -0,0 +1,263 @@
+package pbthrift
+
+import (
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+// Convert raw content with the task, names and fields keep their case.
+func convertContent(t *testing.T, task int, content string, nestedTypes bool) string {
+	t.Helper()
+	r, err := NewRunnerWithConfig(RunnerConfig{
+		Task:        task,
+		RawContent:  content,
+		Pipe:        true,
+		NameCase:    "pascalCase",
+		FieldCase:   "snakeCase",
+		NestedTypes: nestedTypes,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := r.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(res)
+}
+
+func TestNestedTypesRoundTrip(t *testing.T) {
+	// UserRequest is not annotated by proto2thrift, so it's not nested into User on the way back
+	proto := `syntax = "proto3";
+message User {
+	string name = 1;
+	Address address = 2;
+	repeated Address.Kind kinds = 3;
+	message Address {
+		string city = 1;
+		Kind kind = 2;
+		enum Kind {
+			home = 0;
+			work = 1;
+		}
+	}
+}
+message UserRequest {
+	User user = 1;
+	User.Address address = 2;
+}
+`
+	thrift := convertContent(t, TASK_CONTENT_PROTO2THRIFT, proto, true)
+	if !strings.Contains(thrift, `(pbthrift.nested = "User.Address")`) {
+		t.Fatalf("nested types are not annotated:\n%s", thrift)
+	}
+	if got := convertContent(t, TASK_CONTENT_THRIFT2PROTO, thrift, true); got != proto {
+		t.Errorf("round trip =\n%s\nwant\n%s", got, proto)
+	}
+}
+
+func TestNestedTypesConvention(t *testing.T) {
+	cases := []struct {
+		name        string
+		nestedTypes bool
+		thrift      string
+		want        string
+	}{
+		{
+			name:        "prefixed names are nested in files without annotation",
+			nestedTypes: true,
+			thrift: `struct User {
+	1: UserAddress address
+}
+struct UserAddress {
+	1: string city
+}
+struct UserRequest {
+	1: User user
+}
+`,
+			want: `syntax = "proto3";
+message User {
+	Address address = 1;
+	message Address {
+		string city = 1;
+	}
+	message Request {
+		User user = 1;
+	}
+}
+`,
+		},
+		{
+			name:        "prefixed names are kept at top level in annotated files",
+			nestedTypes: true,
+			thrift: `struct User {
+	1: UserAddress address
+}
+struct UserAddress {
+	1: string city
+} (pbthrift.nested = "User.Address")
+struct UserRequest {
+	1: User user
+}
+`,
+			want: `syntax = "proto3";
+message User {
+	Address address = 1;
+	message Address {
+		string city = 1;
+	}
+}
+message UserRequest {
+	User user = 1;
+}
+`,
+		},
+		{
+			name: "nothing is nested without the option",
+			thrift: `struct User {
+	1: string name
+}
+struct UserRequest {
+	1: User user
+}
+`,
+			want: `syntax = "proto3";
+message User {
+	string name = 1;
+}
+message UserRequest {
+	User user = 1;
+}
+`,
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			if got := convertContent(t, TASK_CONTENT_THRIFT2PROTO, c.thrift, c.nestedTypes); got != c.want {
+				t.Errorf("got\n%s\nwant\n%s", got, c.want)
+			}
+		})
+	}
+}
+
+// Thrift files including files in another -I path and next to them, referring types by include aliases
+var crossFileThrifts = fstest.MapFS{
+	"idl/api/user.thrift": {Data: []byte(`namespace go api.user
+
+include "common/base.thrift"
+include "types.thrift"
+
+struct User {
+	1: base.Base base
+	2: types.Kind kind
+	3: Local local
+	4: list<base.Base> bases
+	5: map<string, types.Profile> profiles
+}
+struct Local {
+	1: string name
+}
+`)},
+	"idl/api/types.thrift": {Data: []byte(`namespace go api.types
+
+enum Kind {
+	A = 0
+}
+struct Profile {
+	1: string name
+}
+`)},
+	"vendor/common/base.thrift": {Data: []byte(`namespace go common
+
+struct Base {
+	1: string id
+}
+`)},
+}
+
+func TestThrift2ProtoCrossFileReferences(t *testing.T) {
+	user := func(imports string) string {
+		return `// generated by protobuf-thrift from api/user.thrift; DO NOT EDIT
+
+syntax = "proto3";
+package api.user;
+
+` + imports + `
+message User {
+	common.Base base = 1;
+	api.types.Kind kind = 2;
+	Local local = 3;
+	repeated common.Base bases = 4;
+	map<string, api.types.Profile> profiles = 5;
+}
+message Local {
+	string name = 1;
+}
+`
+	}
+	cases := []struct {
+		name       string
+		importRoot string
+		want       map[string]string
+	}{
+		{
+			name: "include paths as written",
+			want: map[string]string{
+				"api/user.proto": user("import \"common/base.proto\";\nimport \"types.proto\";\n"),
+				"api/types.proto": `// generated by protobuf-thrift from api/types.thrift; DO NOT EDIT
+
+syntax = "proto3";
+package api.types;
+
+enum Kind {
+	a = 0;
+}
+message Profile {
+	string name = 1;
+}
+`,
+				"common/base.proto": `// generated by protobuf-thrift from common/base.thrift; DO NOT EDIT
+
+syntax = "proto3";
+package common;
+
+message Base {
+	string id = 1;
+}
+`,
+			},
+		},
+		{
+			name:       "include paths relative to import root",
+			importRoot: "/out",
+			want: map[string]string{
+				"api/user.proto": user("import \"gen/common/base.proto\";\nimport \"gen/api/types.proto\";\n"),
+			},
+		},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			files := pipeFiles(t, RunnerConfig{
+				FS:          crossFileThrifts,
+				Task:        TASK_FILE_THRIFT2PROTO,
+				InputPath:   "idl/api/user.thrift",
+				OutputDir:   "/out/gen",
+				Recursive:   true,
+				ImportPaths: []string{"idl", "vendor"},
+				ImportRoot:  c.importRoot,
+				NameCase:    "pascalCase",
+				FieldCase:   "snakeCase",
+			})
+			if len(files) != 3 {
+				t.Errorf("converted files = %d, want 3", len(files))
+			}
+			for path, want := range c.want {
+				if got := files[path]; got != want {
+					t.Errorf("%s =\n%s\nwant\n%s", path, got, want)
+				}
+			}
+		})
+	}
+}
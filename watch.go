@@ -0,0 +1,156 @@
+package pbthrift
+
+import (
+	"sort"
+	"time"
+
+	"github.com/YYCoder/protobuf-thrift/utils/logger"
+)
+
+// Default interval for polling input files in watch mode
+const DefaultWatchInterval = time.Second
+
+// State of a watched file, used to find changed files without reading them
+type fileState struct {
+	modTime time.Time
+	size    int64
+	exists  bool
+}
+
+// Convert files, then keep polling input files and files included by them every interval, and convert again when any
+// of them changes, until stop is closed. Only changed files and files including them transitively are converted
+// again, by the dependency graph recorded in the last run. Errors of each run are logged instead of returned, so that
+// it keeps running while files are being edited.
+func (r *Runner) Watch(interval time.Duration, stop <-chan struct{}) (err error) {
+	if r.Config.Task != TASK_FILE_PROTO2THRIFT && r.Config.Task != TASK_FILE_THRIFT2PROTO {
+		return &OptionError{Option: "watch", Value: "true", Reason: "it requires input file"}
+	}
+	if r.Config.Sink != nil {
+		return &OptionError{Option: "watch", Value: "true", Reason: "it requires files written into output dir"}
+	}
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+
+	var previous *cacheManifest
+	for {
+		var paths []string
+		if previous, paths, err = r.generateOnce(previous); err != nil {
+			logger.Error(err)
+		}
+		states := r.snapshot(paths)
+		logger.Infof("watching %d files for changes", len(states))
+
+		for {
+			select {
+			case <-stop:
+				return nil
+			case <-time.After(interval):
+			}
+			if changed := r.changedFiles(states); len(changed) > 0 {
+				logger.Infof("files changed, convert again: %v", changed)
+				break
+			}
+		}
+	}
+}
+
+// Convert files which are changed since the previous run, return the manifest for the next run and paths to watch.
+// Previous manifest is nil for the first run, it's loaded from output dir if cache is enabled. If the conversion
+// fails, the previous manifest is returned, so that the files are converted again next time.
+func (r *Runner) generateOnce(previous *cacheManifest) (next *cacheManifest, paths []string, err error) {
+	next = previous
+	var gen Generator
+	if gen, err = NewGenerator(r.Config); err != nil {
+		return next, r.watchedFiles(nil), err
+	}
+	g := gen.(*generator)
+	switch {
+	case previous == nil && r.Config.Cache:
+		g.cache = newCache(r.Config)
+	case previous == nil:
+		g.cache = newMemoryCache(r.Config, &cacheManifest{})
+	default:
+		g.cache = newMemoryCache(r.Config, previous)
+		g.cache.persist = r.Config.Cache
+	}
+	if err = g.Generate(); err != nil {
+		return next, r.watchedFiles(g), err
+	}
+	return g.cache.next, r.watchedFiles(g), nil
+}
+
+// Return files to watch, including input files, files included by them, and idl files in input dirs. Files of the
+// failed run are watched too, e.g. a missing included file.
+func (r *Runner) watchedFiles(g *generator) (res []string) {
+	found := map[string]bool{}
+	for _, path := range r.inputFiles() {
+		found[path] = true
+	}
+	if g != nil {
+		for path := range g.fileInfos {
+			found[path] = true
+		}
+		for path := range g.cache.next.Hashes {
+			found[path] = true
+		}
+	}
+	for path := range found {
+		res = append(res, path)
+	}
+	sort.Strings(res)
+	return
+}
+
+// Return input files and idl files in input dirs, dirs themselves are not watched, since their modification time
+// changes with any file in them, e.g. temporary files of editors.
+func (r *Runner) inputFiles() (res []string) {
+	g := &generator{conf: r.Config}
+	for _, inputPath := range r.Config.inputPaths() {
+		if stat, err := statFile(r.Config.FS, inputPath); err != nil || !stat.IsDir() {
+			res = append(res, inputPath)
+			continue
+		}
+		files, _ := g.getAllFileFromDir(inputPath)
+		for _, file := range files {
+			res = append(res, file.absPath)
+		}
+	}
+	return
+}
+
+func (r *Runner) snapshot(paths []string) (res map[string]fileState) {
+	res = make(map[string]fileState, len(paths))
+	for _, path := range paths {
+		res[path] = r.fileState(path)
+	}
+	return
+}
+
+func (r *Runner) fileState(path string) (res fileState) {
+	stat, err := statFile(r.Config.FS, path)
+	if err != nil {
+		return
+	}
+	return fileState{modTime: stat.ModTime(), size: stat.Size(), exists: true}
+}
+
+func (s fileState) equal(other fileState) bool {
+	return s.exists == other.exists && s.size == other.size && s.modTime.Equal(other.modTime)
+}
+
+// Return watched files changed since the snapshot, and new idl files in input dirs, sorted.
+func (r *Runner) changedFiles(states map[string]fileState) (res []string) {
+	for path, state := range states {
+		if !r.fileState(path).equal(state) {
+			res = append(res, path)
+		}
+	}
+	for _, path := range r.inputFiles() {
+		if _, found := states[path]; !found {
+			res = append(res, path)
+		}
+	}
+	sort.Strings(res)
+	return
+}
@@ -0,0 +1,104 @@
+package pbthrift
+
+import (
+	"bytes"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestWatchIncludedFiles(t *testing.T) {
+	root := t.TempDir()
+	proto := func(pkg string, imports ...string) string {
+		content := "syntax = \"proto3\";\npackage " + pkg + ";\n"
+		for _, i := range imports {
+			content += "import \"" + i + "\";\n"
+		}
+		return content + "message " + strings.ToUpper(pkg) + " {\n\tstring id = 1;\n}\n"
+	}
+	writeFiles(t, root, map[string]string{
+		"idl/a.proto":    proto("a", "b.proto"),
+		"idl/b.proto":    proto("b"),
+		"vendor/c.proto": proto("c"),
+	})
+
+	var summary bytes.Buffer
+	r, err := NewRunnerWithConfig(RunnerConfig{
+		Task:        TASK_FILE_PROTO2THRIFT,
+		InputPath:   filepath.Join(root, "idl", "a.proto"),
+		OutputDir:   filepath.Join(root, "out"),
+		Recursive:   true,
+		ImportPaths: []string{filepath.Join(root, "vendor")},
+		Summary:     &summary,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name    string
+		files   map[string]string // files edited before the step
+		changed []string
+		written []string
+		watched []string
+	}{
+		{
+			name:    "first run",
+			written: []string{"a.thrift", "b.thrift"},
+			watched: []string{"idl/a.proto", "idl/b.proto"},
+		},
+		{
+			name:    "newly included file is converted and watched",
+			files:   map[string]string{"idl/a.proto": proto("a", "b.proto", "c.proto")},
+			changed: []string{"idl/a.proto"},
+			written: []string{"a.thrift", "c.thrift"},
+			watched: []string{"idl/a.proto", "idl/b.proto", "vendor/c.proto"},
+		},
+		{
+			name:    "change of newly included file is found",
+			files:   map[string]string{"vendor/c.proto": proto("c") + "message D {\n}\n"},
+			changed: []string{"vendor/c.proto"},
+			written: []string{"a.thrift", "c.thrift"},
+			watched: []string{"idl/a.proto", "idl/b.proto", "vendor/c.proto"},
+		},
+		{
+			name:    "file not included any more is not watched",
+			files:   map[string]string{"idl/a.proto": proto("a", "b.proto") + "message E {\n}\n"},
+			changed: []string{"idl/a.proto"},
+			written: []string{"a.thrift"},
+			watched: []string{"idl/a.proto", "idl/b.proto"},
+		},
+	}
+	var previous *cacheManifest
+	var states map[string]fileState
+	rel := func(paths []string) (res []string) {
+		res = []string{}
+		for _, path := range paths {
+			path, _ = filepath.Rel(root, path)
+			res = append(res, filepath.ToSlash(path))
+		}
+		return
+	}
+	for _, s := range steps {
+		writeFiles(t, root, s.files)
+		if states != nil {
+			if changed := rel(r.changedFiles(states)); !reflect.DeepEqual(changed, s.changed) {
+				t.Errorf("%s: changed = %q, want %q", s.name, changed, s.changed)
+			}
+		}
+
+		summary.Reset()
+		var paths []string
+		if previous, paths, err = r.generateOnce(previous); err != nil {
+			t.Fatal(err)
+		}
+		states = r.snapshot(paths)
+		if written := strings.Split(strings.TrimSpace(summary.String()), "\n")[1:]; !reflect.DeepEqual(written, s.written) {
+			t.Errorf("%s: written = %q, want %q", s.name, written, s.written)
+		}
+		if watched := rel(paths); !reflect.DeepEqual(watched, s.watched) {
+			t.Errorf("%s: watched = %q, want %q", s.name, watched, s.watched)
+		}
+	}
+}